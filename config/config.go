@@ -10,9 +10,16 @@ import (
 )
 
 type Config struct {
-	GithubApps GithubApps
-	SlackApps  SlackApps
-	Scanner    Scanner
+	GithubApps      GithubApps
+	SlackApps       SlackApps
+	Scanners        Scanners
+	ScanMode        string
+	MalformedPolicy string
+	Workers         Workers
+	Verifiers       Verifiers
+	KnownSecrets    KnownSecrets
+	Honeytokens     Honeytokens
+	SLA             SLA
 }
 
 func Init() (err error) {
@@ -39,14 +46,56 @@ func BuildAppsConfig() (Config, error) {
 		return Config{}, e
 	}
 
-	sc, e := buildScannerConfig()
+	sc, e := buildScannersConfig()
+	if e != nil {
+		return Config{}, e
+	}
+
+	sm, e := buildScanMode()
+	if e != nil {
+		return Config{}, e
+	}
+
+	mp, e := buildMalformedPolicy()
+	if e != nil {
+		return Config{}, e
+	}
+
+	wk, e := buildWorkersConfig()
+	if e != nil {
+		return Config{}, e
+	}
+
+	vf, e := buildVerifiersConfig()
+	if e != nil {
+		return Config{}, e
+	}
+
+	ks, e := BuildKnownSecretsConfig()
+	if e != nil {
+		return Config{}, e
+	}
+
+	ht, e := BuildHoneytokensConfig()
+	if e != nil {
+		return Config{}, e
+	}
+
+	sla, e := buildSLAConfig()
 	if e != nil {
 		return Config{}, e
 	}
 
 	return Config{
-		GithubApps: gh,
-		SlackApps:  sl,
-		Scanner:    sc,
+		GithubApps:      gh,
+		SlackApps:       sl,
+		Scanners:        sc,
+		ScanMode:        sm,
+		MalformedPolicy: mp,
+		Workers:         wk,
+		Verifiers:       vf,
+		KnownSecrets:    ks,
+		Honeytokens:     ht,
+		SLA:             sla,
 	}, nil
 }
@@ -6,6 +6,7 @@ package config
 
 import (
 	"os"
+	"strings"
 
 	"github.com/salesforce/lobster-pot/db"
 	log "github.com/sirupsen/logrus"
@@ -14,12 +15,32 @@ import (
 )
 
 func initDB() (err error) {
+	dburl := os.Getenv("DATABASE_URL")
+
+	// the in-memory store lets the whole pipeline run locally without a postgres server
+	if dburl == "memory://" {
+		log.Warn("Using the in-memory store, nothing is kept after a restart")
+		db.SetStore(db.NewMemoryStore())
+		return nil
+	}
+
 	//setup the database if DATABASE_URL is set (postgres for now)
-	if dburl := os.Getenv("DATABASE_URL"); dburl != "" {
+	if dburl != "" {
 		if err := db.Connect(dburl); err != nil {
 			log.Error(err)
 			return err
 		}
+
+		// the schema is migrated at startup, unless DB_MIGRATE_ON_START is false and
+		// the migrations are applied with "lobster-pot migrate"
+		if strings.ToLower(os.Getenv("DB_MIGRATE_ON_START")) != "false" {
+			version, err := db.Migrate()
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			log.WithFields(log.Fields{"version": version}).Debug("Database schema up to date")
+		}
 	}
 	return nil
 }
@@ -0,0 +1,45 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package config
+
+import (
+	"fmt"
+	"os"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// minimum length of the salt, so the hashes of short secrets can't be brute forced without it
+const minKnownSecretsSaltLength = 16
+
+type KnownSecrets struct {
+	Salt string // Salt of the hashes of the known secrets. The registry is disabled if empty
+}
+
+type Honeytokens struct {
+	Salt string // Salt of the hashes of the honeytokens. The honeytokens can't be detected if empty
+}
+
+// BuildKnownSecretsConfig reads the configuration of the known secrets registry
+func BuildKnownSecretsConfig() (k KnownSecrets, err error) {
+	k.Salt = os.Getenv("KNOWN_SECRETS_SALT")
+	if k.Salt != "" && len(k.Salt) < minKnownSecretsSaltLength {
+		return KnownSecrets{}, fmt.Errorf("KNOWN_SECRETS_SALT must be at least %d characters long", minKnownSecretsSaltLength)
+	}
+	return k, nil
+}
+
+// BuildHoneytokensConfig reads the configuration of the honeytokens registry. The salt defaults to
+// the salt of the known secrets, which the honeytokens used before they had their own.
+func BuildHoneytokensConfig() (h Honeytokens, err error) {
+	h.Salt = os.Getenv("HONEYTOKENS_SALT")
+	if h.Salt == "" {
+		h.Salt = os.Getenv("KNOWN_SECRETS_SALT")
+	}
+	if h.Salt != "" && len(h.Salt) < minKnownSecretsSaltLength {
+		return Honeytokens{}, fmt.Errorf("HONEYTOKENS_SALT must be at least %d characters long", minKnownSecretsSaltLength)
+	}
+	return h, nil
+}
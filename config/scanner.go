@@ -7,26 +7,87 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	log "github.com/sirupsen/logrus"
 )
 
 type Scanner struct {
-	Type      string // Can be "binary" or "embedded"
-	Name      string // Scanner name is used to identify the scanner and unmarshal the output
-	RulesFile string
-	Binary    string
-	Arguments string // Arguments to pass to the scanner, %s will be replaced with the target folder
+	Type       string // Can be "binary" or "embedded"
+	Name       string // Scanner name is used to identify the scanner and unmarshal the output
+	RulesFile  string // Rules used by the golang scanner
+	MatchLevel int    // Minimum match-level of the rules used by the golang scanner
+	Binary     string
+	Arguments  string // Arguments to pass to the scanner, %s will be replaced with the target folder
+
+	FindingsExitCodes []int         // Exit codes of the binary meaning findings were found, rather than an error
+	Timeout           time.Duration // Deadline of a scan, the scanner is killed when it is reached
 }
 
-func buildScannerConfig() (s Scanner, err error) {
+// defaultScannerTimeout is the deadline of a scan when SCANNER_TIMEOUT is not set
+const defaultScannerTimeout = 10 * time.Minute
+
+// List of scanners run on each scan
+type Scanners []Scanner
+
+// buildScannersConfig builds the list of scanners to run.
+// A single scanner is configured with the SCANNER_<VARNAME> variables, several scanners
+// with the SCANNER_<VARNAME>_<NUMERICAL_ID> variables.
+func buildScannersConfig() (scanners Scanners, err error) {
+	re := regexp.MustCompile("^SCANNER_NAME_([\\d]+)=(.*)$")
+
+	var indexes []int
+	for _, element := range os.Environ() {
+		match := re.FindStringSubmatch(element)
+		if len(match) > 0 {
+			index, _ := strconv.Atoi(match[1])
+			indexes = append(indexes, index)
+		}
+	}
+
+	// no numbered scanner, fall back on the single scanner variables
+	if len(indexes) == 0 {
+		s, e := buildScannerConfig(os.Getenv)
+		if e != nil {
+			return nil, e
+		}
+		return Scanners{s}, nil
+	}
 
-	// TODO: allow for multiple scanners at the same time
+	// keep the order of the ids, so the scanners always run in the same order
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		index := strconv.Itoa(i)
+		s, e := buildScannerConfig(func(name string) string {
+			return os.Getenv(buildEnvVarName(index, name))
+		})
+		if e != nil {
+			log.WithFields(log.Fields{
+				"index": index,
+			}).Error("Error parsing env vars")
+			return nil, e
+		}
+		scanners = append(scanners, s)
+	}
+	return scanners, nil
+}
 
-	stype := os.Getenv("SCANNER_TYPE")
+// buildScannerConfig builds a scanner config, reading the variables with getenv
+func buildScannerConfig(getenv func(string) string) (s Scanner, err error) {
 
+	stype := getenv("SCANNER_TYPE")
+
+	// without a binary to run, default to the golang scanner so no extra binaries are needed
 	if stype == "" {
-		stype = "binary"
+		stype = "golang"
+		if getenv("SCANNER_BINARY") != "" {
+			stype = "binary"
+		}
 	}
 
 	if !isValidScannerType(stype) {
@@ -37,7 +98,7 @@ func buildScannerConfig() (s Scanner, err error) {
 	s.Type = stype
 
 	if s.Type == "binary" {
-		binary := os.Getenv("SCANNER_BINARY")
+		binary := getenv("SCANNER_BINARY")
 		if binary == "" {
 			err = fmt.Errorf("No scanner binary specified")
 			return Scanner{}, err
@@ -45,34 +106,115 @@ func buildScannerConfig() (s Scanner, err error) {
 		s.Binary = binary
 
 		// The arguments passed to the binary, each separated by a semi-colon.
-		arguments := os.Getenv("SCANNER_ARGUMENTS")
+		arguments := getenv("SCANNER_ARGUMENTS")
 		if arguments == "" {
 			err = fmt.Errorf("No scanner arguments specified")
 			return Scanner{}, err
 		}
 		s.Arguments = arguments
+
+		// Some scanners exit with a non-zero code when they find secrets, e.g. "1" for gitleaks.
+		// The codes are separated by a comma.
+		if codes := getenv("SCANNER_FINDINGS_EXIT_CODES"); codes != "" {
+			for _, c := range strings.Split(codes, ",") {
+				code, e := strconv.Atoi(strings.TrimSpace(c))
+				if e != nil || code <= 0 {
+					err = fmt.Errorf("Invalid scanner findings exit code: %s", c)
+					return Scanner{}, err
+				}
+				s.FindingsExitCodes = append(s.FindingsExitCodes, code)
+			}
+		}
 	}
 
-	// Scanner Name can be grover, semgrep, or wraith right now. Will add more later.
-	sname := os.Getenv("SCANNER_NAME")
-	if !IsValidScannerName(sname) {
+	// Scanner Name must match an engine or a parser registered in the scanner package
+	sname := getenv("SCANNER_NAME")
+	if sname == "" && s.Type == "golang" {
+		sname = "golang"
+	}
+	if !IsValidScanner(s.Type, sname) {
 		err = fmt.Errorf("Invalid scanner name: %s", sname)
 		return Scanner{}, err
 	}
 	s.Name = sname
 
+	// Timeout is a duration such as "90s" or "10m", "0" disables it
+	s.Timeout = defaultScannerTimeout
+	if t := getenv("SCANNER_TIMEOUT"); t != "" {
+		s.Timeout, err = time.ParseDuration(t)
+		if err != nil || s.Timeout < 0 {
+			err = fmt.Errorf("Invalid scanner timeout: %s", t)
+			return Scanner{}, err
+		}
+	}
+
+	if s.Name == "golang" {
+		s.RulesFile = getenv("SCANNER_RULES_FILE")
+		if s.RulesFile == "" {
+			s.RulesFile = "rules/default_rules.yml"
+		}
+
+		s.MatchLevel = 0
+		if ml := getenv("SCANNER_MATCH_LEVEL"); ml != "" {
+			s.MatchLevel, err = strconv.Atoi(ml)
+			if err != nil {
+				err = fmt.Errorf("Invalid scanner match level: %s", ml)
+				return Scanner{}, err
+			}
+		}
+	}
+
 	return s, nil
 }
 
-func IsValidScannerName(name string) bool {
-	switch name {
-	case
-		"wraith",
-		"grover",
-		"semgrep":
-		return true
+// buildScanMode returns the scan mode, "full" or "diff". In "diff" mode, only the lines
+// added by a commit are reported as new findings
+func buildScanMode() (mode string, err error) {
+	mode = os.Getenv("SCANNER_MODE")
+	if mode == "" {
+		mode = "full"
 	}
-	return false
+	if !isValidScannerMode(mode) {
+		err = fmt.Errorf("Invalid scanner mode: %s", mode)
+		return "", err
+	}
+	return mode, nil
+}
+
+// ScannerRegistry knows the available scanners: the embedded engines for the "golang" type,
+// and the output parsers for the "binary" type
+type ScannerRegistry interface {
+	IsRegistered(stype, name string) bool
+}
+
+var scannerRegistry ScannerRegistry
+
+// SetScannerRegistry sets the registry used to validate the scanners.
+// It is called by the scanner package when it is loaded.
+func SetScannerRegistry(r ScannerRegistry) {
+	scannerRegistry = r
+}
+
+// IsValidScanner returns true if a scanner of that type and name is registered
+func IsValidScanner(stype, name string) bool {
+	if scannerRegistry == nil {
+		return false
+	}
+	return scannerRegistry.IsRegistered(stype, name)
+}
+
+// buildMalformedPolicy returns what to do with the findings holding a malformed token,
+// "mark" (default) to report them with a low-confidence marker, or "drop"
+func buildMalformedPolicy() (policy string, err error) {
+	policy = os.Getenv("SCANNER_MALFORMED_POLICY")
+	if policy == "" {
+		policy = "mark"
+	}
+	if policy != "mark" && policy != "drop" {
+		err = fmt.Errorf("Invalid scanner malformed policy: %s", policy)
+		return "", err
+	}
+	return policy, nil
 }
 
 func isValidScannerType(stype string) bool {
@@ -82,3 +224,11 @@ func isValidScannerType(stype string) bool {
 	}
 	return false
 }
+
+func isValidScannerMode(mode string) bool {
+	switch mode {
+	case "full", "diff":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+	"gopkg.in/yaml.v2"
+)
+
+// SLAPolicy is how long a finding can wait for triage before reminders and escalation
+type SLAPolicy struct {
+	Reminder   time.Duration // Delay before the first reminder, and between two reminders. 0 disables the reminders
+	Escalation time.Duration // Delay before the escalation. 0 disables the escalation
+	EscalateTo string        // Slack ID of the user group or user mentioned on escalation
+}
+
+type SLA struct {
+	Default SLAPolicy
+	Repos   map[string]SLAPolicy // Policies by lowercase "owner/repo"
+	Levels  map[string]SLAPolicy // Policies by lowercase level of the finding, such as "critical"
+}
+
+// slaPolicyFile is the format of the file set with SLA_POLICY_FILE. Empty fields default to the SLA_* variables.
+type slaPolicyFile struct {
+	Repos  map[string]slaPolicyDef `yaml:"repos"`
+	Levels map[string]slaPolicyDef `yaml:"levels"`
+}
+
+type slaPolicyDef struct {
+	Reminder   string `yaml:"reminder"`
+	Escalation string `yaml:"escalation"`
+	EscalateTo string `yaml:"escalate_to"`
+}
+
+// Enabled returns true if any policy sends reminders or escalates
+func (s SLA) Enabled() bool {
+	enabled := func(p SLAPolicy) bool { return p.Reminder > 0 || p.Escalation > 0 }
+	if enabled(s.Default) {
+		return true
+	}
+	for _, p := range s.Repos {
+		if enabled(p) {
+			return true
+		}
+	}
+	for _, p := range s.Levels {
+		if enabled(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns the policy of a finding: the policy of its repository if there is one,
+// else the policy of its level, else the default policy
+func (s SLA) Policy(repo, level string) SLAPolicy {
+	if p, ok := s.Repos[strings.ToLower(repo)]; ok {
+		return p
+	}
+	if p, ok := s.Levels[strings.ToLower(level)]; ok {
+		return p
+	}
+	return s.Default
+}
+
+func buildSLAConfig() (s SLA, err error) {
+	s.Default, err = buildSLAPolicy(slaPolicyDef{
+		Reminder:   os.Getenv("SLA_REMINDER"),
+		Escalation: os.Getenv("SLA_ESCALATION"),
+		EscalateTo: os.Getenv("SLA_ESCALATE_TO"),
+	}, SLAPolicy{})
+	if err != nil {
+		return SLA{}, err
+	}
+
+	path := os.Getenv("SLA_POLICY_FILE")
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return SLA{}, err
+	}
+	var pf slaPolicyFile
+	err = yaml.Unmarshal(data, &pf)
+	if err != nil {
+		return SLA{}, fmt.Errorf("Invalid SLA policy file %s: %s", path, err)
+	}
+
+	s.Repos = make(map[string]SLAPolicy)
+	for repo, def := range pf.Repos {
+		s.Repos[strings.ToLower(repo)], err = buildSLAPolicy(def, s.Default)
+		if err != nil {
+			return SLA{}, fmt.Errorf("Invalid SLA policy for repo %s: %s", repo, err)
+		}
+	}
+	s.Levels = make(map[string]SLAPolicy)
+	for level, def := range pf.Levels {
+		s.Levels[strings.ToLower(level)], err = buildSLAPolicy(def, s.Default)
+		if err != nil {
+			return SLA{}, fmt.Errorf("Invalid SLA policy for level %s: %s", level, err)
+		}
+	}
+
+	return s, nil
+}
+
+// slackMentionID matches the Slack ID of a user group (S0123ABCD) or a user (U0123ABCD, W0123ABCD)
+var slackMentionID = regexp.MustCompile(`^[SUW][A-Z0-9]{2,}$`)
+
+// buildSLAPolicy parses a policy, the empty fields are taken from base
+func buildSLAPolicy(def slaPolicyDef, base SLAPolicy) (p SLAPolicy, err error) {
+	p = base
+	if def.Reminder != "" {
+		p.Reminder, err = time.ParseDuration(def.Reminder)
+		if err != nil || p.Reminder < 0 {
+			return SLAPolicy{}, fmt.Errorf("Invalid SLA reminder: %s", def.Reminder)
+		}
+	}
+	if def.Escalation != "" {
+		p.Escalation, err = time.ParseDuration(def.Escalation)
+		if err != nil || p.Escalation < 0 {
+			return SLAPolicy{}, fmt.Errorf("Invalid SLA escalation: %s", def.Escalation)
+		}
+	}
+	if def.EscalateTo != "" {
+		if !slackMentionID.MatchString(def.EscalateTo) && def.EscalateTo != "here" && def.EscalateTo != "channel" {
+			return SLAPolicy{}, fmt.Errorf("Invalid SLA escalation target: %s, must be the ID of a user group or user, here or channel", def.EscalateTo)
+		}
+		p.EscalateTo = def.EscalateTo
+	}
+	if p.Escalation > 0 && p.EscalateTo == "" {
+		return SLAPolicy{}, fmt.Errorf("No user group or user to escalate to, set SLA_ESCALATE_TO")
+	}
+	return p, nil
+}
@@ -16,6 +16,7 @@ import (
 type SlackApp struct {
 	Id            string
 	Channel       string
+	AlertChannel  string // high-priority channel of the honeytoken alerts, Channel if not set
 	Token         string
 	SigningSecret string
 }
@@ -66,6 +67,10 @@ func buildSlackAppConfigFromEnviron(index string) (app *SlackApp, err error) {
 		l.Error(err.Error())
 		return nil, err
 	}
+	alertChannel := os.Getenv(buildEnvVarName(index, "SLACK_ALERT_CHANNEL"))
+	if alertChannel == "" {
+		alertChannel = channel
+	}
 	token := os.Getenv(buildEnvVarName(index, "SLACK_TOKEN"))
 	if token == "" {
 		err = fmt.Errorf("SLACK_TOKEN not set")
@@ -82,6 +87,7 @@ func buildSlackAppConfigFromEnviron(index string) (app *SlackApp, err error) {
 	app = &SlackApp{
 		Id:            appID,
 		Channel:       channel,
+		AlertChannel:  alertChannel,
 		Token:         token,
 		SigningSecret: signingSecret,
 	}
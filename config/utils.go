@@ -4,10 +4,27 @@
 // For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
 
 // for multiple orgs, the env vars the variables are in the form  GITHUB_<VARNAME>_<NUMERICAL_ID>
 // buildEnvVerName returns the env var name for the var and id
 func buildEnvVarName(index string, name string) string {
 	return fmt.Sprintf("%s_%s", name, index)
 }
+
+// intFromEnv returns the integer value of the env var, or def if it is not set
+func intFromEnv(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, v)
+	}
+	return i, nil
+}
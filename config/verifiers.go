@@ -0,0 +1,54 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+type Verifiers struct {
+	Enabled   bool              // Check if the detected secrets are live, by calling the provider's API
+	Endpoints map[string]string // API endpoint of each verifier, by lowercase verifier name. Defaults to the provider's API
+	Timeout   time.Duration     // Deadline of a single verification
+}
+
+const defaultVerifierTimeout = 10 * time.Second
+
+func buildVerifiersConfig() (v Verifiers, err error) {
+
+	switch strings.ToLower(os.Getenv("VERIFY_SECRETS")) {
+	case "", "false", "0":
+	case "true", "1":
+		v.Enabled = true
+	default:
+		return Verifiers{}, fmt.Errorf("Invalid VERIFY_SECRETS: %s", os.Getenv("VERIFY_SECRETS"))
+	}
+
+	v.Timeout = defaultVerifierTimeout
+	if t := os.Getenv("VERIFIER_TIMEOUT"); t != "" {
+		v.Timeout, err = time.ParseDuration(t)
+		if err != nil || v.Timeout <= 0 {
+			return Verifiers{}, fmt.Errorf("Invalid VERIFIER_TIMEOUT: %s", t)
+		}
+	}
+
+	// VERIFIER_ENDPOINT_<NAME> overrides the endpoint of a verifier, e.g. to use a proxy
+	re := regexp.MustCompile("^VERIFIER_ENDPOINT_([A-Z0-9_]+)=(.*)$")
+	v.Endpoints = make(map[string]string)
+	for _, element := range os.Environ() {
+		match := re.FindStringSubmatch(element)
+		if len(match) > 0 && match[2] != "" {
+			v.Endpoints[strings.ToLower(match[1])] = strings.TrimSuffix(match[2], "/")
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package config
+
+import (
+	"fmt"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+type Workers struct {
+	Concurrency int // Number of jobs processed in parallel. 0 disables the workers in the process
+	MaxAttempts int // Number of attempts before a job is moved to the dead-letter state
+}
+
+func buildWorkersConfig() (w Workers, err error) {
+
+	w.Concurrency, err = intFromEnv("JOB_WORKERS", 2)
+	if err != nil {
+		return Workers{}, err
+	}
+	if w.Concurrency < 0 {
+		return Workers{}, fmt.Errorf("Invalid JOB_WORKERS: %d", w.Concurrency)
+	}
+
+	w.MaxAttempts, err = intFromEnv("JOB_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return Workers{}, err
+	}
+	if w.MaxAttempts < 1 {
+		return Workers{}, fmt.Errorf("Invalid JOB_MAX_ATTEMPTS: %d", w.MaxAttempts)
+	}
+
+	return w, nil
+}
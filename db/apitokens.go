@@ -0,0 +1,123 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIToken is a token of the REST API. Only the sha256 of the token is stored.
+type APIToken struct {
+	ID      int
+	Name    string // who or what uses the token, recorded as the actor of the status changes made with it
+	Hash    string
+	Scopes  []string
+	Revoked bool
+	Created int
+}
+
+// HasScope returns true if the token was granted the scope
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertAPIToken registers the hash of an API token
+func InsertAPIToken(name, hash string, scopes []string) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.InsertAPIToken(name, hash, scopes)
+}
+
+func (p *postgresStore) InsertAPIToken(name, hash string, scopes []string) (int, error) {
+	id := 0
+	now := int(time.Now().Unix())
+	err := p.db.QueryRow("INSERT INTO apiTokens(name,hash,scopes,revoked,created) VALUES ($1,$2,$3,false,$4) RETURNING uid",
+		name, hash, strings.Join(scopes, ","), now).Scan(&id)
+	return id, err
+}
+
+// GetAPIToken returns the token that isn't revoked with that hash, or nil if there is none
+func GetAPIToken(hash string) (*APIToken, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetAPIToken(hash)
+}
+
+func (p *postgresStore) GetAPIToken(hash string) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	err := p.db.QueryRow("SELECT uid, name, hash, scopes, revoked, created FROM apiTokens WHERE hash=$1 AND revoked=false", hash).
+		Scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Revoked, &t.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	return &t, nil
+}
+
+// RevokeAPIToken revokes a token. Revoked tokens are kept, so their name stays known.
+func RevokeAPIToken(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.RevokeAPIToken(id)
+}
+
+func (p *postgresStore) RevokeAPIToken(id int) error {
+	res, err := p.db.Exec("UPDATE apiTokens SET revoked=true WHERE uid=$1 AND revoked=false", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no active API token with id %d", id)
+	}
+	return nil
+}
+
+// GetAPITokens returns the registered tokens, including the revoked ones
+func GetAPITokens() ([]APIToken, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetAPITokens()
+}
+
+func (p *postgresStore) GetAPITokens() ([]APIToken, error) {
+	rows, err := p.db.Query("SELECT uid, name, hash, scopes, revoked, created FROM apiTokens ORDER BY uid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		err = rows.Scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Revoked, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
@@ -5,16 +5,19 @@
 package db
 
 import (
-	"crypto/sha256"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
-var db *sql.DB
+// postgresStore is the Store backed by a postgres database
+type postgresStore struct {
+	db *sql.DB
+}
 
 const (
 	NEW_FINDING       = 0
@@ -22,92 +25,39 @@ const (
 	KNOWN_SAFE        = 2
 	VERIFIED_POSITIVE = 3
 	REPEAT_FINDING    = 4
-)
-
-var FindingValues = []string{"NEW_FINDING", "FALSE,POSITIVE", "KNOWN_SAFE", "VERIFIED_POSITIVE", "REPEAT_FINDING"}
-
-func initDB() (err error) {
-
-	createTblStatement := ` CREATE TABLE IF NOT EXISTS scans
-    (
-        uid serial NOT NULL,
-		commit character varying(40) NOT NULL,
-		fid character varying(64) NOT NULL,
-		repo character varying(100) NOT NULL,
-		filepath character varying(255) NOT NULL,
-		status int,
-		updated int
-    )
-	WITH (OIDS=FALSE); `
-
-	stmt, err := db.Prepare(createTblStatement)
-	if err != nil {
-		return err
-	}
-
-	_, err = stmt.Exec()
 
-	createTblStatement = ` CREATE TABLE IF NOT EXISTS commits
-    (
-        uid serial NOT NULL,
-        sha character varying(40) NOT NULL,
-		repo character varying(100) NOT NULL,
-		files int,
-		findings int,
-		date int
-    )
-	WITH (OIDS=FALSE); `
-
-	stmt, err = db.Prepare(createTblStatement)
-	if err != nil {
-		return err
-	}
-
-	_, err = stmt.Exec()
-
-	createTblStatement = ` CREATE TABLE IF NOT EXISTS slackMessages
-    (
-        uid serial NOT NULL,
-        fid character varying(64) NOT NULL,
-		msgid character varying(255) NOT NULL,
-		sentat int
-    )
-	WITH (OIDS=FALSE); `
-
-	stmt, err = db.Prepare(createTblStatement)
-	if err != nil {
-		return err
-	}
+	// remediation of the verified secrets
+	ROTATION_PENDING  = 5
+	ROTATED           = 6
+	REMOVED_FROM_HEAD = 7
+)
 
-	_, err = stmt.Exec()
-
-	defer stmt.Close()
-
-	return
-}
+var FindingValues = []string{"NEW_FINDING", "FALSE,POSITIVE", "KNOWN_SAFE", "VERIFIED_POSITIVE", "REPEAT_FINDING",
+	"ROTATION_PENDING", "ROTATED", "REMOVED_FROM_HEAD"}
 
 // InsertFinding checks to see if a finding has already been created,
 // if not, it adds a new entry to the database.
 // If the entry already exists, the
 // if it has changed, update the current entry and trigger a new notification
-func InsertFinding(sha, repo, filepath, comment string) (status int, err error) {
-	if db == nil {
-		return -1, fmt.Errorf("database not initialized")
+func InsertFinding(f Finding) (status int, err error) {
+	if store == nil {
+		return -1, errNotInitialized
 	}
+	return store.InsertFinding(f)
+}
 
-	fid := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s.%s.%s", repo, filepath, comment))))
-
+func (p *postgresStore) InsertFinding(f Finding) (status int, err error) {
 	eStatus := -1
 
 	//check if finding already exists in DB
-	e := db.QueryRow("SELECT status FROM scans WHERE fid LIKE $1", fid).Scan(&eStatus)
+	e := p.db.QueryRow("SELECT status FROM findings WHERE fid = $1", f.FID).Scan(&eStatus)
 	if e != nil && e != sql.ErrNoRows {
 		return 0, e
 	}
 	if eStatus != -1 { // finding already exists in the
 		if eStatus == NEW_FINDING {
 			// this is a repeat of an existing finding update to reflect
-			return UpdateFinding(fid, REPEAT_FINDING)
+			return p.SetFindingStatus(f.FID, REPEAT_FINDING, ScanActor, "")
 		}
 		return eStatus, nil
 	}
@@ -115,14 +65,20 @@ func InsertFinding(sha, repo, filepath, comment string) (status int, err error)
 	//it doesn't exist, insert it
 	now := int(time.Now().Unix())
 
-	stmt, err := db.Prepare("INSERT INTO scans(commit,fid,repo,filepath,status,updated) VALUES ($1,$2,$3,$4,$5,$6)")
+	stmt, err := p.db.Prepare(`INSERT INTO findings(fid,repo,path,ruleid,description,severity,scanner,status,firstseen,lastseen,updated)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$9,$9)`)
 
 	if err != nil {
 		return -1, err
 	}
-	_, err = stmt.Exec(sha, fid, repo, filepath, NEW_FINDING, now)
+	_, err = stmt.Exec(f.FID, f.Repo, f.Path, f.RuleID, f.Description, f.Severity, f.Scanner, NEW_FINDING, now)
 	defer stmt.Close()
 
+	if err != nil {
+		return -1, err
+	}
+
+	err = insertFindingEvent(p.db, f.FID, ScanActor, -1, NEW_FINDING, "", now)
 	if err != nil {
 		return -1, err
 	}
@@ -134,8 +90,15 @@ func InsertFinding(sha, repo, filepath, comment string) (status int, err error)
 
 // SelectFinding returns the status and updated date of a finding
 func SelectFinding(fid string) (state int, updated int, er error) {
+	if store == nil {
+		return -1, -1, errNotInitialized
+	}
+	return store.SelectFinding(fid)
+}
+
+func (p *postgresStore) SelectFinding(fid string) (state int, updated int, er error) {
 
-	e := db.QueryRow("SELECT status,updated FROM scans WHERE fid LIKE $1", fid).Scan(&state, &updated)
+	e := p.db.QueryRow("SELECT status,updated FROM findings WHERE fid = $1", fid).Scan(&state, &updated)
 	if e != nil && e != sql.ErrNoRows {
 		return 0, -1, e
 	}
@@ -145,28 +108,36 @@ func SelectFinding(fid string) (state int, updated int, er error) {
 	return
 }
 
-// UpdateFinding sets the new status of an existing finding and updates the date at which it was set
+// UpdateFinding sets the new status of an existing finding and updates the date at which it was set.
+// The status changes made by the scans are recorded in the history of the finding.
 func UpdateFinding(fid string, status int) (state int, er error) {
+	return SetFindingStatus(fid, status, ScanActor, "")
+}
 
-	stmt, err := db.Prepare("UPDATE scans SET status=$1, updated=$2 WHERE fid LIKE $3")
-	if err != nil {
-		return -1, err
-	}
-	now := int(time.Now().Unix())
-	_, err = stmt.Exec(status, now, fid)
-	if err != nil {
-		return -1, err
+// UpdateFindingVerification saves the result of the verification of the finding's secret
+func UpdateFindingVerification(fid, verification string) error {
+	if store == nil {
+		return errNotInitialized
 	}
-	defer stmt.Close()
+	return store.UpdateFindingVerification(fid, verification)
+}
 
-	// updated with new status
-	return status, nil
+func (p *postgresStore) UpdateFindingVerification(fid, verification string) error {
+	_, err := p.db.Exec("UPDATE findings SET verification=$1 WHERE fid = $2", verification, fid)
+	return err
 }
 
 // InsertCommitScan inserts information about the scan run for a commit
 func InsertCommitScan(commit, repo string, totalFiles, findings int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertCommitScan(commit, repo, totalFiles, findings)
+}
 
-	stmt, err := db.Prepare("INSERT INTO commits(sha, repo, files, findings, date) VALUES ($1,$2,$3,$4,$5)")
+func (p *postgresStore) InsertCommitScan(commit, repo string, totalFiles, findings int) error {
+
+	stmt, err := p.db.Prepare("INSERT INTO commits(sha, repo, files, findings, date) VALUES ($1,$2,$3,$4,$5)")
 	if err != nil {
 		return err
 	}
@@ -181,8 +152,108 @@ func InsertCommitScan(commit, repo string, totalFiles, findings int) error {
 	return nil
 }
 
+// IsCommitScanned returns true if the commit has already been scanned for that repo
+func IsCommitScanned(commit, repo string) (bool, error) {
+	if store == nil {
+		return false, errNotInitialized
+	}
+	return store.IsCommitScanned(commit, repo)
+}
+
+func (p *postgresStore) IsCommitScanned(commit, repo string) (bool, error) {
+	count := 0
+	e := p.db.QueryRow("SELECT COUNT(*) FROM commits WHERE sha = $1 AND repo = $2", commit, repo).Scan(&count)
+	if e != nil {
+		return false, e
+	}
+	return count > 0, nil
+}
+
+// CommitScan is the result of the scan of a commit
+type CommitScan struct {
+	SHA      string
+	Repo     string
+	Files    int // files scanned, the deleted ones aren't
+	Findings int
+	Date     int
+}
+
+// CommitFilter selects the commit scans to list. The empty fields don't filter.
+type CommitFilter struct {
+	Org    string // compared without case
+	Repo   string // owner/repo
+	Since  int    // scanned at or after
+	Until  int    // scanned before
+	Limit  int    // 0 doesn't limit
+	Offset int
+}
+
+// ListCommitScans returns the scans of the commits matching the filter, the most recent first
+func ListCommitScans(filter CommitFilter) ([]CommitScan, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.ListCommitScans(filter)
+}
+
+func (p *postgresStore) ListCommitScans(filter CommitFilter) ([]CommitScan, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.Org != "" {
+		add("lower(split_part(repo, '/', 1)) = lower($%d)", filter.Org)
+	}
+	if filter.Repo != "" {
+		add("repo = $%d", filter.Repo)
+	}
+	if filter.Since > 0 {
+		add("date >= $%d", filter.Since)
+	}
+	if filter.Until > 0 {
+		add("date < $%d", filter.Until)
+	}
+
+	query := "SELECT sha, repo, COALESCE(files, 0), COALESCE(findings, 0), COALESCE(date, 0) FROM commits"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY date DESC, uid DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	var limit interface{} // LIMIT NULL doesn't limit
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	args = append(args, limit, filter.Offset)
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scans []CommitScan
+	for rows.Next() {
+		var cs CommitScan
+		err = rows.Scan(&cs.SHA, &cs.Repo, &cs.Files, &cs.Findings, &cs.Date)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, cs)
+	}
+	return scans, rows.Err()
+}
+
 // InsertSlackMessage inserts information about the scan run for a commit
 func InsertSlackMessage(fid, msgid string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertSlackMessage(fid, msgid)
+}
+
+func (p *postgresStore) InsertSlackMessage(fid, msgid string) error {
 
 	// It is pointless to insert a message if msgid is empty, since it's the
 	// "primary key" for slackMessages.
@@ -190,7 +261,7 @@ func InsertSlackMessage(fid, msgid string) error {
 		return fmt.Errorf("msgid is empty, not inserting")
 	}
 
-	stmt, err := db.Prepare("INSERT INTO slackMessages(fid,msgid,sentat) VALUES ($1,$2,$3)")
+	stmt, err := p.db.Prepare("INSERT INTO slackMessages(fid,msgid,sentat) VALUES ($1,$2,$3)")
 	if err != nil {
 		return err
 	}
@@ -206,10 +277,17 @@ func InsertSlackMessage(fid, msgid string) error {
 }
 
 func GetSlackMessageFid(msgid string) (string, error) {
+	if store == nil {
+		return "", errNotInitialized
+	}
+	return store.GetSlackMessageFid(msgid)
+}
+
+func (p *postgresStore) GetSlackMessageFid(msgid string) (string, error) {
 	fid := ""
 
 	//check if finding already exists in DB
-	e := db.QueryRow("SELECT fid FROM slackMessages WHERE msgid LIKE $1", msgid).Scan(&fid)
+	e := p.db.QueryRow("SELECT fid FROM slackMessages WHERE msgid = $1", msgid).Scan(&fid)
 	if e != nil && e != sql.ErrNoRows {
 		return "", e
 	}
@@ -217,9 +295,16 @@ func GetSlackMessageFid(msgid string) (string, error) {
 }
 
 func GetSlackMessagesFromFid(fid string) ([]string, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetSlackMessagesFromFid(fid)
+}
+
+func (p *postgresStore) GetSlackMessagesFromFid(fid string) ([]string, error) {
 
 	//check if finding already exists in DB
-	rows, err := db.Query("SELECT msgid FROM slackMessages WHERE fid LIKE $1", fid)
+	rows, err := p.db.Query("SELECT msgid FROM slackMessages WHERE fid = $1", fid)
 	if err != nil {
 		return nil, err
 	}
@@ -242,19 +327,125 @@ func GetSlackMessagesFromFid(fid string) ([]string, error) {
 	return fids, nil
 }
 
-//Connect establishes a connection with the back-end database
-func Connect(dburl string) (err error) {
-	db, err = sql.Open("postgres", dburl)
+// CheckRun is a GitHub check run published for the head commit of a pull request
+type CheckRun struct {
+	ID         int64
+	Repo       string
+	SHA        string
+	Conclusion string
+}
+
+// InsertCheckRun saves a check run, along with the fids of the findings it reported
+func InsertCheckRun(checkID int64, repo, sha, conclusion string, fids []string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertCheckRun(checkID, repo, sha, conclusion, fids)
+}
+
+func (p *postgresStore) InsertCheckRun(checkID int64, repo, sha, conclusion string, fids []string) error {
+	stmt, err := p.db.Prepare("INSERT INTO checkRuns(checkid,repo,sha,conclusion,updated) VALUES ($1,$2,$3,$4,$5)")
 	if err != nil {
-		log.Error(err)
 		return err
 	}
-	//defer db.Close()
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(checkID, repo, sha, conclusion, now)
+	if err != nil {
+		return err
+	}
+
+	fstmt, err := p.db.Prepare("INSERT INTO checkRunFindings(checkid,fid) VALUES ($1,$2)")
+	if err != nil {
+		return err
+	}
+	defer fstmt.Close()
+	for _, fid := range fids {
+		_, err = fstmt.Exec(checkID, fid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCheckRunsFromFid returns the check runs that reported a finding
+func GetCheckRunsFromFid(fid string) ([]CheckRun, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetCheckRunsFromFid(fid)
+}
 
-	err = initDB()
+func (p *postgresStore) GetCheckRunsFromFid(fid string) ([]CheckRun, error) {
+	rows, err := p.db.Query(`SELECT c.checkid, c.repo, c.sha, c.conclusion FROM checkRuns c
+		JOIN checkRunFindings f ON f.checkid = c.checkid
+		WHERE f.fid = $1`, fid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []CheckRun
+	for rows.Next() {
+		var cr CheckRun
+		err := rows.Scan(&cr.ID, &cr.Repo, &cr.SHA, &cr.Conclusion)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, cr)
+	}
+	return runs, rows.Err()
+}
+
+// CountUntriagedCheckRunFindings returns how many findings reported by a check run
+// are still waiting to be triaged
+func CountUntriagedCheckRunFindings(checkID int64) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.CountUntriagedCheckRunFindings(checkID)
+}
+
+func (p *postgresStore) CountUntriagedCheckRunFindings(checkID int64) (int, error) {
+	count := 0
+	e := p.db.QueryRow(`SELECT COUNT(DISTINCT f.fid) FROM checkRunFindings f
+		JOIN findings s ON s.fid = f.fid
+		WHERE f.checkid = $1 AND s.status IN ($2, $3)`, checkID, NEW_FINDING, REPEAT_FINDING).Scan(&count)
+	if e != nil {
+		return 0, e
+	}
+	return count, nil
+}
+
+// UpdateCheckRunConclusion sets the conclusion of a check run
+func UpdateCheckRunConclusion(checkID int64, conclusion string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.UpdateCheckRunConclusion(checkID, conclusion)
+}
+
+func (p *postgresStore) UpdateCheckRunConclusion(checkID int64, conclusion string) error {
+	stmt, err := p.db.Prepare("UPDATE checkRuns SET conclusion=$1, updated=$2 WHERE checkid=$3")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(conclusion, now, checkID)
+	return err
+}
+
+//Connect establishes a connection with the back-end database
+func Connect(dburl string) (err error) {
+	conn, err := sql.Open("postgres", dburl)
 	if err != nil {
 		log.Error(err)
+		return err
 	}
+	//defer db.Close()
 
+	SetStore(&postgresStore{db: conn})
 	return
 }
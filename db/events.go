@@ -0,0 +1,164 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Sources of the status changes of the findings
+const (
+	SOURCE_SCAN   = "scan"
+	SOURCE_SLACK  = "slack"
+	SOURCE_API    = "api"
+	SOURCE_EXPIRY = "expiry"
+)
+
+// Actor is who changed the status of a finding
+type Actor struct {
+	ID     string // Slack user ID, API user, or "lobster-pot" for the changes made by the scans
+	Name   string
+	Source string
+}
+
+// ScanActor is the actor of the status changes made by the scans
+var ScanActor = Actor{ID: "lobster-pot", Name: "lobster-pot", Source: SOURCE_SCAN}
+
+// ExpiryActor is the actor reopening the findings whose exception expired
+var ExpiryActor = Actor{ID: "lobster-pot", Name: "lobster-pot", Source: SOURCE_EXPIRY}
+
+// FindingEvent is a status change of a finding. Events are never updated nor deleted.
+type FindingEvent struct {
+	ID        int
+	FID       string
+	Actor     Actor
+	OldStatus int // -1 when the finding was created
+	NewStatus int
+	Comment   string
+	Created   int
+}
+
+// SetFindingStatus changes the status of a finding, and records the change in its history
+// along with who made it. Setting the same status only updates the date, unless a comment
+// is given: a decision confirmed with a reason is recorded as well.
+func SetFindingStatus(fid string, status int, actor Actor, comment string) (int, error) {
+	if store == nil {
+		return -1, errNotInitialized
+	}
+	return store.SetFindingStatus(fid, status, actor, comment)
+}
+
+func (p *postgresStore) SetFindingStatus(fid string, status int, actor Actor, comment string) (int, error) {
+	return p.setFindingStatus(fid, status, nil, actor, comment)
+}
+
+// TriageFinding sets the status of a finding decided by a triager, and the date at which the
+// decision expires, 0 if it never expires, at once. The change is recorded like with SetFindingStatus,
+// and a change of the expiry alone is recorded as well.
+func TriageFinding(fid string, status, expires int, actor Actor, comment string) (int, error) {
+	if store == nil {
+		return -1, errNotInitialized
+	}
+	return store.TriageFinding(fid, status, expires, actor, comment)
+}
+
+func (p *postgresStore) TriageFinding(fid string, status, expires int, actor Actor, comment string) (int, error) {
+	return p.setFindingStatus(fid, status, &expires, actor, comment)
+}
+
+// setFindingStatus sets the status of a finding, and its expiry if expires isn't nil, in a single transaction
+func (p *postgresStore) setFindingStatus(fid string, status int, expires *int, actor Actor, comment string) (int, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	old, oldExpires := -1, 0
+	err = tx.QueryRow("SELECT status, COALESCE(expires, 0) FROM findings WHERE fid = $1 FOR UPDATE", fid).Scan(&old, &oldExpires)
+	if err == sql.ErrNoRows {
+		return -1, fmt.Errorf("no finding with fid %s", fid)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	now := int(time.Now().Unix())
+	_, err = tx.Exec("UPDATE findings SET status=$1, updated=$2 WHERE fid = $3", status, now, fid)
+	if err != nil {
+		return -1, err
+	}
+
+	expiryChanged := false
+	if expires != nil {
+		var e interface{}
+		if *expires > 0 {
+			e = *expires
+		}
+		_, err = tx.Exec("UPDATE findings SET expires=$1 WHERE fid = $2", e, fid)
+		if err != nil {
+			return -1, err
+		}
+		expiryChanged = *expires != oldExpires
+	}
+
+	if old != status || comment != "" || expiryChanged {
+		err = insertFindingEvent(tx, fid, actor, old, status, comment, now)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return status, tx.Commit()
+}
+
+// GetFindingHistory returns every status change of a finding, the oldest first
+func GetFindingHistory(fid string) ([]FindingEvent, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetFindingHistory(fid)
+}
+
+func (p *postgresStore) GetFindingHistory(fid string) ([]FindingEvent, error) {
+	rows, err := p.db.Query(`SELECT uid, fid, actor, actorname, source, COALESCE(oldstatus, -1), newstatus, COALESCE(comment, ''), created
+		FROM finding_events WHERE fid=$1 ORDER BY uid`, fid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []FindingEvent
+	for rows.Next() {
+		var e FindingEvent
+		err = rows.Scan(&e.ID, &e.FID, &e.Actor.ID, &e.Actor.Name, &e.Actor.Source, &e.OldStatus, &e.NewStatus, &e.Comment, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertFindingEvent(ex execer, fid string, actor Actor, old, status int, comment string, created int) error {
+	var oldStatus interface{}
+	if old >= 0 {
+		oldStatus = old
+	}
+	var c interface{}
+	if comment != "" {
+		c = comment
+	}
+	_, err := ex.Exec(`INSERT INTO finding_events(fid,actor,actorname,source,oldstatus,newstatus,comment,created)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`, fid, actor.ID, actor.Name, actor.Source, oldStatus, status, c, created)
+	return err
+}
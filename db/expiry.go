@@ -0,0 +1,92 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ExpiredFinding is a finding marked as FALSE_POSITIVE or KNOWN_SAFE whose exception expired
+type ExpiredFinding struct {
+	FID     string
+	Repo    string
+	Status  int
+	Expires int
+}
+
+// GetExpiredFindings returns the FALSE_POSITIVE and KNOWN_SAFE findings whose exception expired before now
+func GetExpiredFindings(now time.Time) ([]ExpiredFinding, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetExpiredFindings(now)
+}
+
+func (p *postgresStore) GetExpiredFindings(now time.Time) ([]ExpiredFinding, error) {
+	rows, err := p.db.Query(`SELECT fid, repo, status, expires FROM findings
+		WHERE expires IS NOT NULL AND expires <= $1 AND status IN ($2,$3)`, int(now.Unix()), FALSE_POSITIVE, KNOWN_SAFE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []ExpiredFinding
+	for rows.Next() {
+		var f ExpiredFinding
+		err = rows.Scan(&f.FID, &f.Repo, &f.Status, &f.Expires)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// ExpireFinding sets a finding whose exception expired back to NEW_FINDING, and records the change
+// in its history. It returns false if the exception hasn't expired, or was already lifted by another process.
+func ExpireFinding(fid string) (bool, error) {
+	if store == nil {
+		return false, errNotInitialized
+	}
+	return store.ExpireFinding(fid)
+}
+
+func (p *postgresStore) ExpireFinding(fid string) (bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var status int
+	var expires sql.NullInt64
+	err = tx.QueryRow("SELECT status, expires FROM findings WHERE fid = $1 FOR UPDATE", fid).Scan(&status, &expires)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("no finding with fid %s", fid)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := int(time.Now().Unix())
+	if !expires.Valid || int(expires.Int64) > now || (status != FALSE_POSITIVE && status != KNOWN_SAFE) {
+		return false, nil
+	}
+
+	_, err = tx.Exec("UPDATE findings SET status=$1, expires=NULL, updated=$2 WHERE fid = $3", NEW_FINDING, now, fid)
+	if err != nil {
+		return false, err
+	}
+
+	comment := fmt.Sprintf("exception expired on %s", time.Unix(expires.Int64, 0).UTC().Format(time.RFC3339))
+	err = insertFindingEvent(tx, fid, ExpiryActor, status, NEW_FINDING, comment, now)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
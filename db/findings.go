@@ -0,0 +1,201 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Finding is a possible secret in a file of a repository. Its fid is the sha256 of
+// "<owner>/<repo>.<path>.<secret>", so the same secret in the same file is always the same finding.
+type Finding struct {
+	FID          string
+	Repo         string // owner/repo
+	Path         string // path of the file, with a leading slash
+	RuleID       string
+	Description  string
+	Severity     string // level reported by the scanner, such as "critical"
+	Scanner      string // scanners that reported the finding, separated by commas
+	Status       int
+	Verification string // live, revoked or unknown, empty if the secret wasn't verified
+	Expires      int    // date at which the triage decision stops applying, 0 if it never expires
+	FirstSeen    int
+	LastSeen     int
+	Updated      int // date of the last report or status change
+}
+
+// Occurrence is a sighting of a finding, in a commit
+type Occurrence struct {
+	ID     int
+	FID    string
+	SHA    string
+	Line   string // line or range of lines, such as "12-14"
+	Pusher string // who pushed the commit, or opened the pull request
+	Seen   int
+}
+
+// InsertOccurrence records a sighting of a finding, and updates the date the finding was last seen.
+// A finding seen again on the same line of the same commit is only recorded once.
+func InsertOccurrence(o Occurrence) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertOccurrence(o)
+}
+
+func (p *postgresStore) InsertOccurrence(o Occurrence) error {
+	now := int(time.Now().Unix())
+	_, err := p.db.Exec(`INSERT INTO occurrences(fid,sha,line,pusher,seen) VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (fid, sha, line) DO NOTHING`, o.FID, o.SHA, o.Line, o.Pusher, now)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec("UPDATE findings SET lastseen=$1 WHERE fid = $2", now, o.FID)
+	return err
+}
+
+// GetFinding returns a finding, or nil if there is none with that fid
+func GetFinding(fid string) (*Finding, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetFinding(fid)
+}
+
+// findingColumns are the columns read by scanFinding
+const findingColumns = `fid, repo, path, ruleid, description, severity, scanner, status,
+	COALESCE(verification, ''), COALESCE(expires, 0), firstseen, lastseen, updated`
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFinding(row scanner) (f Finding, err error) {
+	err = row.Scan(&f.FID, &f.Repo, &f.Path, &f.RuleID, &f.Description, &f.Severity, &f.Scanner,
+		&f.Status, &f.Verification, &f.Expires, &f.FirstSeen, &f.LastSeen, &f.Updated)
+	return
+}
+
+func (p *postgresStore) GetFinding(fid string) (*Finding, error) {
+	f, err := scanFinding(p.db.QueryRow("SELECT "+findingColumns+" FROM findings WHERE fid = $1", fid))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// GetOccurrences returns the sightings of a finding, the oldest first
+func GetOccurrences(fid string) ([]Occurrence, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetOccurrences(fid)
+}
+
+func (p *postgresStore) GetOccurrences(fid string) ([]Occurrence, error) {
+	rows, err := p.db.Query("SELECT uid, fid, sha, line, pusher, seen FROM occurrences WHERE fid = $1 ORDER BY uid", fid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var occurrences []Occurrence
+	for rows.Next() {
+		var o Occurrence
+		err = rows.Scan(&o.ID, &o.FID, &o.SHA, &o.Line, &o.Pusher, &o.Seen)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, rows.Err()
+}
+
+// FindingFilter selects the findings to list. The empty fields don't filter.
+type FindingFilter struct {
+	Org      string // compared without case
+	Repo     string // owner/repo
+	Statuses []int
+	Scanner  string
+	RuleID   string
+	Since    int // first seen at or after
+	Until    int // first seen before
+	Limit    int // 0 doesn't limit
+	Offset   int
+}
+
+// ListFindings returns the findings matching the filter, the most recently first seen first
+func ListFindings(filter FindingFilter) ([]Finding, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.ListFindings(filter)
+}
+
+func (p *postgresStore) ListFindings(filter FindingFilter) ([]Finding, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.Org != "" {
+		add("lower(split_part(repo, '/', 1)) = lower($%d)", filter.Org)
+	}
+	if filter.Repo != "" {
+		add("repo = $%d", filter.Repo)
+	}
+	if len(filter.Statuses) > 0 {
+		add("status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.Scanner != "" {
+		add("$%d = ANY(string_to_array(scanner, ','))", filter.Scanner)
+	}
+	if filter.RuleID != "" {
+		add("ruleid = $%d", filter.RuleID)
+	}
+	if filter.Since > 0 {
+		add("firstseen >= $%d", filter.Since)
+	}
+	if filter.Until > 0 {
+		add("firstseen < $%d", filter.Until)
+	}
+
+	query := "SELECT " + findingColumns + " FROM findings"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY firstseen DESC, fid LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	var limit interface{} // LIMIT NULL doesn't limit
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	args = append(args, limit, filter.Offset)
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []Finding
+	for rows.Next() {
+		f, err := scanFinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
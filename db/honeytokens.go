@@ -0,0 +1,85 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Honeytoken is a canary credential, planted where it should never leave from
+type Honeytoken struct {
+	ID       int
+	Hash     string
+	Location string // where the honeytoken was planted
+	Owner    string // who planted it
+	Created  int
+}
+
+// InsertHoneytoken registers the salted hash of a honeytoken
+func InsertHoneytoken(hash, location, owner string) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.InsertHoneytoken(hash, location, owner)
+}
+
+func (p *postgresStore) InsertHoneytoken(hash, location, owner string) (int, error) {
+	id := 0
+	now := int(time.Now().Unix())
+	err := p.db.QueryRow("INSERT INTO honeytokens(hash,location,owner,created) VALUES ($1,$2,$3,$4) RETURNING uid",
+		hash, location, owner, now).Scan(&id)
+	return id, err
+}
+
+// DeleteHoneytoken removes a honeytoken from the registry
+func DeleteHoneytoken(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.DeleteHoneytoken(id)
+}
+
+func (p *postgresStore) DeleteHoneytoken(id int) error {
+	res, err := p.db.Exec("DELETE FROM honeytokens WHERE uid=$1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no honeytoken with id %d", id)
+	}
+	return nil
+}
+
+// GetHoneytokens returns the registered honeytokens
+func GetHoneytokens() ([]Honeytoken, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetHoneytokens()
+}
+
+func (p *postgresStore) GetHoneytokens() ([]Honeytoken, error) {
+	rows, err := p.db.Query("SELECT uid, hash, location, owner, created FROM honeytokens ORDER BY uid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Honeytoken
+	for rows.Next() {
+		var t Honeytoken
+		err = rows.Scan(&t.ID, &t.Hash, &t.Location, &t.Owner, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Job states
+const (
+	JOB_QUEUED  = "queued"
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_DEAD    = "dead"
+)
+
+// JobLease is how long a job can stay running without being renewed before it is considered abandoned
+// (by a crashed or restarted worker) and can be claimed again. Workers renew the lease of their job
+// every JobHeartbeat, so long jobs are never claimed twice.
+const (
+	JobLease     = 5 * time.Minute
+	JobHeartbeat = time.Minute
+)
+
+// Job is a received webhook waiting to be processed
+type Job struct {
+	ID       int
+	Delivery string
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+// InsertJob persists a received webhook as a queued job.
+// A delivery that was already received (GitHub redelivery) is ignored.
+func InsertJob(delivery, event string, payload []byte) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertJob(delivery, event, payload)
+}
+
+func (p *postgresStore) InsertJob(delivery, event string, payload []byte) error {
+	stmt, err := p.db.Prepare(`INSERT INTO jobs(delivery,event,payload,status,attempts,runat,updated)
+		VALUES ($1,$2,$3,$4,0,$5,$5) ON CONFLICT (delivery) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(delivery, event, payload, JOB_QUEUED, now)
+	return err
+}
+
+// ClaimJob marks the next runnable job as running and returns it.
+// Jobs are locked with SKIP LOCKED so that concurrent workers never claim the same job.
+// It returns nil if no job is waiting.
+func ClaimJob() (*Job, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.ClaimJob()
+}
+
+func (p *postgresStore) ClaimJob() (*Job, error) {
+	now := int(time.Now().Unix())
+	expired := int(time.Now().Add(-JobLease).Unix())
+
+	var j Job
+	e := p.db.QueryRow(`UPDATE jobs SET status=$1, attempts=attempts+1, updated=$2
+		WHERE uid = (
+			SELECT uid FROM jobs
+			WHERE (status=$3 AND runat <= $2) OR (status=$1 AND updated < $4)
+			ORDER BY uid
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING uid, delivery, event, payload, attempts`,
+		JOB_RUNNING, now, JOB_QUEUED, expired).Scan(&j.ID, &j.Delivery, &j.Event, &j.Payload, &j.Attempts)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &j, nil
+}
+
+// RenewJob extends the lease of a running job
+func RenewJob(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.RenewJob(id)
+}
+
+func (p *postgresStore) RenewJob(id int) error {
+	_, err := p.db.Exec("UPDATE jobs SET updated=$1 WHERE uid=$2 AND status=$3", int(time.Now().Unix()), id, JOB_RUNNING)
+	return err
+}
+
+// CompleteJob marks a job as done
+func CompleteJob(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.CompleteJob(id)
+}
+
+func (p *postgresStore) CompleteJob(id int) error {
+	return p.setJobStatus(id, JOB_DONE, "", int(time.Now().Unix()))
+}
+
+// RetryJob puts a failed job back in the queue, to be run again at runAt
+func RetryJob(id int, jobErr error, runAt time.Time) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.RetryJob(id, jobErr, runAt)
+}
+
+func (p *postgresStore) RetryJob(id int, jobErr error, runAt time.Time) error {
+	return p.setJobStatus(id, JOB_QUEUED, jobErr.Error(), int(runAt.Unix()))
+}
+
+// KillJob moves a job that failed too many times to the dead-letter state
+func KillJob(id int, jobErr error) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.KillJob(id, jobErr)
+}
+
+func (p *postgresStore) KillJob(id int, jobErr error) error {
+	return p.setJobStatus(id, JOB_DEAD, jobErr.Error(), int(time.Now().Unix()))
+}
+
+func (p *postgresStore) setJobStatus(id int, status, lastError string, runAt int) error {
+	stmt, err := p.db.Prepare("UPDATE jobs SET status=$1, lasterror=$2, runat=$3, updated=$4 WHERE uid=$5")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(status, lastError, runAt, now, id)
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// KnownSecret is a real secret registered by the security team. Only its salted hash is stored.
+type KnownSecret struct {
+	ID      int
+	Hash    string
+	Name    string // what the secret is, e.g. "billing database password"
+	Owner   string // who registered it, or who to contact when it leaks
+	Created int
+}
+
+// InsertKnownSecret registers the salted hash of a secret
+func InsertKnownSecret(hash, name, owner string) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.InsertKnownSecret(hash, name, owner)
+}
+
+func (p *postgresStore) InsertKnownSecret(hash, name, owner string) (int, error) {
+	id := 0
+	now := int(time.Now().Unix())
+	err := p.db.QueryRow("INSERT INTO knownSecrets(hash,name,owner,created) VALUES ($1,$2,$3,$4) RETURNING uid",
+		hash, name, owner, now).Scan(&id)
+	return id, err
+}
+
+// DeleteKnownSecret removes a secret from the registry
+func DeleteKnownSecret(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.DeleteKnownSecret(id)
+}
+
+func (p *postgresStore) DeleteKnownSecret(id int) error {
+	res, err := p.db.Exec("DELETE FROM knownSecrets WHERE uid=$1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no known secret with id %d", id)
+	}
+	return nil
+}
+
+// GetKnownSecrets returns the registered secrets
+func GetKnownSecrets() ([]KnownSecret, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetKnownSecrets()
+}
+
+func (p *postgresStore) GetKnownSecrets() ([]KnownSecret, error) {
+	rows, err := p.db.Query("SELECT uid, hash, name, owner, created FROM knownSecrets ORDER BY uid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []KnownSecret
+	for rows.Next() {
+		var s KnownSecret
+		err = rows.Scan(&s.ID, &s.Hash, &s.Name, &s.Owner, &s.Created)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, rows.Err()
+}
+
+// GetKnownSecretHashes returns the names of the registered secrets, by hash
+func GetKnownSecretHashes() (map[string]string, error) {
+	secrets, err := GetKnownSecrets()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(secrets))
+	for _, s := range secrets {
+		hashes[s.Hash] = s.Name
+	}
+	return hashes, nil
+}
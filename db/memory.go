@@ -0,0 +1,959 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store keeping everything in memory, for local development and tests.
+// Nothing survives a restart, and it can't be shared by several processes.
+type memoryStore struct {
+	mu sync.Mutex
+
+	lastID int // the ids are unique across all the records, like a single sequence
+
+	findings      map[string]*Finding
+	events        []FindingEvent
+	occurrences   []Occurrence
+	reminders     map[string]memReminder
+	commits       []memCommit
+	slackMessages []memSlackMessage
+	outbox        []*memOutboxMessage
+	checkRuns     []*memCheckRun
+	jobs          []*memJob
+	scanErrors    []*memScanError
+	honeytokens   []Honeytoken
+	knownSecrets  []KnownSecret
+	apiTokens     []APIToken
+}
+
+type memReminder struct {
+	since        int
+	reminders    int
+	lastReminder int
+	escalated    int
+}
+
+type memCommit struct {
+	sha      string
+	repo     string
+	files    int
+	findings int
+	date     int
+}
+
+type memSlackMessage struct {
+	id     int
+	fid    string
+	msgid  string
+	sentat int
+}
+
+type memOutboxMessage struct {
+	OutboxMessage
+	runAt   int
+	updated int
+}
+
+type memCheckRun struct {
+	CheckRun
+	fids    []string
+	updated int
+}
+
+type memJob struct {
+	Job
+	status    string
+	lastError string
+	runAt     int
+	updated   int
+}
+
+type memScanError struct {
+	ScanError
+	resolved bool
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		findings:  make(map[string]*Finding),
+		reminders: make(map[string]memReminder),
+	}
+}
+
+func (m *memoryStore) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+func (m *memoryStore) InsertFinding(f Finding) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.findings[f.FID]; ok {
+		if existing.Status == NEW_FINDING {
+			// this is a repeat of an existing finding update to reflect
+			return m.setFindingStatus(f.FID, REPEAT_FINDING, nil, ScanActor, "")
+		}
+		return existing.Status, nil
+	}
+
+	now := int(time.Now().Unix())
+	f.Status = NEW_FINDING
+	f.Verification = ""
+	f.Expires = 0
+	f.FirstSeen, f.LastSeen, f.Updated = now, now, now
+	m.findings[f.FID] = &f
+	m.insertFindingEvent(f.FID, ScanActor, -1, NEW_FINDING, "", now)
+	return NEW_FINDING, nil
+}
+
+func (m *memoryStore) SelectFinding(fid string) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.findings[fid]
+	if !ok {
+		return -1, -1, nil
+	}
+	return f.Status, f.Updated, nil
+}
+
+func (m *memoryStore) GetFinding(fid string) (*Finding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.findings[fid]
+	if !ok {
+		return nil, nil
+	}
+	c := *f
+	return &c, nil
+}
+
+func (m *memoryStore) SetFindingStatus(fid string, status int, actor Actor, comment string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setFindingStatus(fid, status, nil, actor, comment)
+}
+
+func (m *memoryStore) TriageFinding(fid string, status, expires int, actor Actor, comment string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setFindingStatus(fid, status, &expires, actor, comment)
+}
+
+func (m *memoryStore) setFindingStatus(fid string, status int, expires *int, actor Actor, comment string) (int, error) {
+	f, ok := m.findings[fid]
+	if !ok {
+		return -1, fmt.Errorf("no finding with fid %s", fid)
+	}
+
+	now := int(time.Now().Unix())
+	old := f.Status
+	f.Status = status
+	f.Updated = now
+	expiryChanged := false
+	if expires != nil {
+		e := *expires
+		if e < 0 {
+			e = 0
+		}
+		expiryChanged = e != f.Expires
+		f.Expires = e
+	}
+	if old != status || comment != "" || expiryChanged {
+		m.insertFindingEvent(fid, actor, old, status, comment, now)
+	}
+	return status, nil
+}
+
+func (m *memoryStore) insertFindingEvent(fid string, actor Actor, old, status int, comment string, created int) {
+	m.events = append(m.events, FindingEvent{
+		ID:        m.nextID(),
+		FID:       fid,
+		Actor:     actor,
+		OldStatus: old,
+		NewStatus: status,
+		Comment:   comment,
+		Created:   created,
+	})
+}
+
+func (m *memoryStore) UpdateFindingVerification(fid, verification string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.findings[fid]; ok {
+		f.Verification = verification
+	}
+	return nil
+}
+
+func (m *memoryStore) GetFindingHistory(fid string) ([]FindingEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []FindingEvent
+	for _, e := range m.events {
+		if e.FID == fid {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryStore) InsertOccurrence(o Occurrence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := int(time.Now().Unix())
+	seen := false
+	for _, e := range m.occurrences {
+		if e.FID == o.FID && e.SHA == o.SHA && e.Line == o.Line {
+			seen = true
+			break
+		}
+	}
+	if !seen {
+		o.ID = m.nextID()
+		o.Seen = now
+		m.occurrences = append(m.occurrences, o)
+	}
+	if f, ok := m.findings[o.FID]; ok {
+		f.LastSeen = now
+	}
+	return nil
+}
+
+func (m *memoryStore) GetOccurrences(fid string) ([]Occurrence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var occurrences []Occurrence
+	for _, o := range m.occurrences {
+		if o.FID == fid {
+			occurrences = append(occurrences, o)
+		}
+	}
+	return occurrences, nil
+}
+
+func (m *memoryStore) GetOpenFileFindings(repo, filepath string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fids []string
+	for _, f := range m.sortedFindings() {
+		if f.Repo != repo || f.Path != filepath {
+			continue
+		}
+		switch f.Status {
+		case NEW_FINDING, REPEAT_FINDING, VERIFIED_POSITIVE, ROTATION_PENDING, ROTATED:
+			fids = append(fids, f.FID)
+		}
+	}
+	return fids, nil
+}
+
+// sortedFindings returns the findings in the order they were first seen, so the results don't
+// depend on the order of the map
+func (m *memoryStore) sortedFindings() []*Finding {
+	findings := make([]*Finding, 0, len(m.findings))
+	for _, f := range m.findings {
+		findings = append(findings, f)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].FirstSeen != findings[j].FirstSeen {
+			return findings[i].FirstSeen < findings[j].FirstSeen
+		}
+		return findings[i].FID < findings[j].FID
+	})
+	return findings
+}
+
+func (m *memoryStore) GetExpiredFindings(now time.Time) ([]ExpiredFinding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var findings []ExpiredFinding
+	for _, f := range m.sortedFindings() {
+		if f.Expires > 0 && f.Expires <= int(now.Unix()) && (f.Status == FALSE_POSITIVE || f.Status == KNOWN_SAFE) {
+			findings = append(findings, ExpiredFinding{FID: f.FID, Repo: f.Repo, Status: f.Status, Expires: f.Expires})
+		}
+	}
+	return findings, nil
+}
+
+func (m *memoryStore) ExpireFinding(fid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.findings[fid]
+	if !ok {
+		return false, fmt.Errorf("no finding with fid %s", fid)
+	}
+
+	now := int(time.Now().Unix())
+	if f.Expires == 0 || f.Expires > now || (f.Status != FALSE_POSITIVE && f.Status != KNOWN_SAFE) {
+		return false, nil
+	}
+
+	old, expires := f.Status, f.Expires
+	f.Status = NEW_FINDING
+	f.Expires = 0
+	f.Updated = now
+
+	comment := fmt.Sprintf("exception expired on %s", time.Unix(int64(expires), 0).UTC().Format(time.RFC3339))
+	m.insertFindingEvent(fid, ExpiryActor, old, NEW_FINDING, comment, now)
+	return true, nil
+}
+
+func (m *memoryStore) GetUntriagedFindings() ([]UntriagedFinding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var findings []UntriagedFinding
+	for _, s := range m.sortedFindings() {
+		if s.Status != NEW_FINDING && s.Status != REPEAT_FINDING {
+			continue
+		}
+
+		f := UntriagedFinding{FID: s.FID, Repo: s.Repo, Level: s.Severity, Since: s.FirstSeen}
+		for _, e := range m.events {
+			if e.FID == s.FID && isUntriaged(e.NewStatus) && !isUntriaged(e.OldStatus) && e.Created > f.Since {
+				f.Since = e.Created
+			}
+		}
+		if r, ok := m.reminders[s.FID]; ok {
+			f.storedSince, f.Reminders, f.storedLastReminder, f.Escalated = r.since, r.reminders, r.lastReminder, r.escalated
+		}
+		var first *memSlackMessage
+		for i, msg := range m.slackMessages {
+			if msg.fid == s.FID && (first == nil || msg.sentat < first.sentat) {
+				first = &m.slackMessages[i]
+			}
+		}
+		if first != nil {
+			f.MessageTS = first.msgid
+		}
+
+		f.LastReminder = f.storedLastReminder
+		if f.storedSince != f.Since {
+			f.Reminders, f.LastReminder, f.Escalated = 0, 0, 0
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// isUntriaged returns true if a finding with that status is waiting for triage
+func isUntriaged(status int) bool {
+	return status == NEW_FINDING || status == REPEAT_FINDING
+}
+
+func (m *memoryStore) RecordReminder(f UntriagedFinding, now int, escalated bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.reminders[f.FID]; ok && (r.since != f.storedSince || r.lastReminder != f.storedLastReminder) {
+		return false, nil
+	}
+
+	escalatedAt := f.Escalated
+	if escalated {
+		escalatedAt = now
+	}
+	m.reminders[f.FID] = memReminder{since: f.Since, reminders: f.Reminders + 1, lastReminder: now, escalated: escalatedAt}
+	return true, nil
+}
+
+func (m *memoryStore) ListFindings(filter FindingFilter) ([]Finding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sorted := m.sortedFindings()
+	var findings []Finding
+	for i := len(sorted) - 1; i >= 0; i-- {
+		f := sorted[i]
+		if (filter.Org != "" && !strings.EqualFold(strings.SplitN(f.Repo, "/", 2)[0], filter.Org)) ||
+			(filter.Repo != "" && f.Repo != filter.Repo) ||
+			(filter.RuleID != "" && f.RuleID != filter.RuleID) ||
+			(filter.Since > 0 && f.FirstSeen < filter.Since) ||
+			(filter.Until > 0 && f.FirstSeen >= filter.Until) {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !containsInt(filter.Statuses, f.Status) {
+			continue
+		}
+		if filter.Scanner != "" && !containsString(strings.Split(f.Scanner, ","), filter.Scanner) {
+			continue
+		}
+		findings = append(findings, *f)
+	}
+	// the most recently first seen first, and by fid for the same date
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].FirstSeen != findings[j].FirstSeen {
+			return findings[i].FirstSeen > findings[j].FirstSeen
+		}
+		return findings[i].FID < findings[j].FID
+	})
+	start, end := pageBounds(len(findings), filter.Offset, filter.Limit)
+	return findings[start:end], nil
+}
+
+func (m *memoryStore) InsertCommitScan(commit, repo string, totalFiles, findings int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.commits = append(m.commits, memCommit{sha: commit, repo: repo, files: totalFiles, findings: findings, date: int(time.Now().Unix())})
+	return nil
+}
+
+func (m *memoryStore) IsCommitScanned(commit, repo string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.commits {
+		if c.sha == commit && c.repo == repo {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) ListCommitScans(filter CommitFilter) ([]CommitScan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var scans []CommitScan
+	for i := len(m.commits) - 1; i >= 0; i-- {
+		c := m.commits[i]
+		if (filter.Org != "" && !strings.EqualFold(strings.SplitN(c.repo, "/", 2)[0], filter.Org)) ||
+			(filter.Repo != "" && c.repo != filter.Repo) ||
+			(filter.Since > 0 && c.date < filter.Since) ||
+			(filter.Until > 0 && c.date >= filter.Until) {
+			continue
+		}
+		scans = append(scans, CommitScan{SHA: c.sha, Repo: c.repo, Files: c.files, Findings: c.findings, Date: c.date})
+	}
+	sort.SliceStable(scans, func(i, j int) bool { return scans[i].Date > scans[j].Date })
+	start, end := pageBounds(len(scans), filter.Offset, filter.Limit)
+	return scans[start:end], nil
+}
+
+func (m *memoryStore) InsertSlackMessage(fid, msgid string) error {
+	// It is pointless to insert a message if msgid is empty, since it's the
+	// "primary key" for slackMessages.
+	if msgid == "" {
+		return fmt.Errorf("msgid is empty, not inserting")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.slackMessages = append(m.slackMessages, memSlackMessage{id: m.nextID(), fid: fid, msgid: msgid, sentat: int(time.Now().Unix())})
+	return nil
+}
+
+func (m *memoryStore) GetSlackMessageFid(msgid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.slackMessages {
+		if msg.msgid == msgid {
+			return msg.fid, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *memoryStore) GetSlackMessagesFromFid(fid string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var msgids []string
+	for _, msg := range m.slackMessages {
+		if msg.fid == fid {
+			msgids = append(msgids, msg.msgid)
+		}
+	}
+	return msgids, nil
+}
+
+func (m *memoryStore) InsertOutboxMessage(fid, appID, channel, message string, priority int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := int(time.Now().Unix())
+	m.outbox = append(m.outbox, &memOutboxMessage{
+		OutboxMessage: OutboxMessage{
+			ID:       m.nextID(),
+			FID:      fid,
+			AppID:    appID,
+			Channel:  channel,
+			Message:  message,
+			Priority: priority,
+			Status:   OUTBOX_PENDING,
+			Created:  now,
+		},
+		runAt:   now,
+		updated: now,
+	})
+	return nil
+}
+
+func (m *memoryStore) ClaimOutboxMessage(appID string) (*OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := int(time.Now().Unix())
+	expired := int(time.Now().Add(-OutboxLease).Unix())
+	var claimed *memOutboxMessage
+	for _, msg := range m.outbox {
+		if msg.AppID != appID {
+			continue
+		}
+		if (msg.Status == OUTBOX_PENDING && msg.runAt <= now) || (msg.Status == OUTBOX_SENDING && msg.updated < expired) {
+			// the messages are in the order of their ids, the first of the highest priority is claimed
+			if claimed == nil || msg.Priority > claimed.Priority {
+				claimed = msg
+			}
+		}
+	}
+	if claimed == nil {
+		return nil, nil
+	}
+	claimed.Status = OUTBOX_SENDING
+	claimed.updated = now
+	c := claimed.OutboxMessage
+	c.LastError = ""
+	return &c, nil
+}
+
+// updateOutboxMessage applies update to the message with that id, if there is one
+func (m *memoryStore) updateOutboxMessage(id int, update func(msg *memOutboxMessage)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.outbox {
+		if msg.ID == id {
+			update(msg)
+			msg.updated = int(time.Now().Unix())
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) MarkOutboxMessageSent(id int) error {
+	return m.updateOutboxMessage(id, func(msg *memOutboxMessage) {
+		msg.Status = OUTBOX_SENT
+		msg.LastError = ""
+	})
+}
+
+func (m *memoryStore) PostponeOutboxMessage(id int, runAt time.Time) error {
+	return m.updateOutboxMessage(id, func(msg *memOutboxMessage) {
+		msg.Status = OUTBOX_PENDING
+		msg.runAt = int(runAt.Unix())
+	})
+}
+
+func (m *memoryStore) RetryOutboxMessage(id int, sendErr error, runAt time.Time) error {
+	return m.updateOutboxMessage(id, func(msg *memOutboxMessage) {
+		msg.Status = OUTBOX_PENDING
+		msg.Attempts++
+		msg.LastError = sendErr.Error()
+		msg.runAt = int(runAt.Unix())
+	})
+}
+
+func (m *memoryStore) KillOutboxMessage(id int, sendErr error) error {
+	return m.updateOutboxMessage(id, func(msg *memOutboxMessage) {
+		msg.Status = OUTBOX_DEAD
+		msg.Attempts++
+		msg.LastError = sendErr.Error()
+	})
+}
+
+func (m *memoryStore) ReplayOutboxMessage(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := int(time.Now().Unix())
+	for _, msg := range m.outbox {
+		if msg.ID == id && msg.Status == OUTBOX_DEAD {
+			msg.Status = OUTBOX_PENDING
+			msg.Attempts = 0
+			msg.runAt = now
+			msg.updated = now
+			return nil
+		}
+	}
+	return fmt.Errorf("no dead message with id %d", id)
+}
+
+func (m *memoryStore) GetDeadOutboxMessages() ([]OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var msgs []OutboxMessage
+	for _, msg := range m.outbox {
+		if msg.Status == OUTBOX_DEAD {
+			msgs = append(msgs, msg.OutboxMessage)
+		}
+	}
+	return msgs, nil
+}
+
+func (m *memoryStore) GetSentOutboxMessage(fid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.outbox) - 1; i >= 0; i-- {
+		msg := m.outbox[i]
+		if msg.FID != fid || msg.Channel != "" || msg.Status != OUTBOX_SENT {
+			continue
+		}
+		var reply struct {
+			ThreadTS string `json:"thread_ts"`
+		}
+		if err := json.Unmarshal([]byte(msg.Message), &reply); err != nil {
+			return "", err
+		}
+		if reply.ThreadTS == "" {
+			return msg.Message, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *memoryStore) InsertCheckRun(checkID int64, repo, sha, conclusion string, fids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, cr := range m.checkRuns {
+		if cr.ID == checkID {
+			return fmt.Errorf("check run %d already exists", checkID)
+		}
+	}
+	m.checkRuns = append(m.checkRuns, &memCheckRun{
+		CheckRun: CheckRun{ID: checkID, Repo: repo, SHA: sha, Conclusion: conclusion},
+		fids:     append([]string(nil), fids...),
+		updated:  int(time.Now().Unix()),
+	})
+	return nil
+}
+
+func (m *memoryStore) GetCheckRunsFromFid(fid string) ([]CheckRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var runs []CheckRun
+	for _, cr := range m.checkRuns {
+		for _, f := range cr.fids {
+			if f == fid {
+				runs = append(runs, cr.CheckRun)
+				break
+			}
+		}
+	}
+	return runs, nil
+}
+
+func (m *memoryStore) CountUntriagedCheckRunFindings(checkID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	untriaged := make(map[string]bool)
+	for _, cr := range m.checkRuns {
+		if cr.ID != checkID {
+			continue
+		}
+		for _, fid := range cr.fids {
+			if f, ok := m.findings[fid]; ok && (f.Status == NEW_FINDING || f.Status == REPEAT_FINDING) {
+				untriaged[fid] = true
+			}
+		}
+	}
+	return len(untriaged), nil
+}
+
+func (m *memoryStore) UpdateCheckRunConclusion(checkID int64, conclusion string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, cr := range m.checkRuns {
+		if cr.ID == checkID {
+			cr.Conclusion = conclusion
+			cr.updated = int(time.Now().Unix())
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) InsertJob(delivery, event string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// a delivery that was already received (GitHub redelivery) is ignored
+	for _, j := range m.jobs {
+		if j.Delivery == delivery {
+			return nil
+		}
+	}
+	now := int(time.Now().Unix())
+	m.jobs = append(m.jobs, &memJob{
+		Job:     Job{ID: m.nextID(), Delivery: delivery, Event: event, Payload: payload},
+		status:  JOB_QUEUED,
+		runAt:   now,
+		updated: now,
+	})
+	return nil
+}
+
+func (m *memoryStore) ClaimJob() (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := int(time.Now().Unix())
+	expired := int(time.Now().Add(-JobLease).Unix())
+	for _, j := range m.jobs {
+		if (j.status == JOB_QUEUED && j.runAt <= now) || (j.status == JOB_RUNNING && j.updated < expired) {
+			j.status = JOB_RUNNING
+			j.Attempts++
+			j.updated = now
+			c := j.Job
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) RenewJob(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		if j.ID == id && j.status == JOB_RUNNING {
+			j.updated = int(time.Now().Unix())
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) CompleteJob(id int) error {
+	return m.setJobStatus(id, JOB_DONE, "", int(time.Now().Unix()))
+}
+
+func (m *memoryStore) RetryJob(id int, jobErr error, runAt time.Time) error {
+	return m.setJobStatus(id, JOB_QUEUED, jobErr.Error(), int(runAt.Unix()))
+}
+
+func (m *memoryStore) KillJob(id int, jobErr error) error {
+	return m.setJobStatus(id, JOB_DEAD, jobErr.Error(), int(time.Now().Unix()))
+}
+
+func (m *memoryStore) setJobStatus(id int, status, lastError string, runAt int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		if j.ID == id {
+			j.status = status
+			j.lastError = lastError
+			j.runAt = runAt
+			j.updated = int(time.Now().Unix())
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) InsertScanError(repo, sha, scanner string, timedOut bool, scanErr, stderr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scanErrors = append(m.scanErrors, &memScanError{ScanError: ScanError{
+		ID:       m.nextID(),
+		Repo:     repo,
+		SHA:      sha,
+		Scanner:  scanner,
+		TimedOut: timedOut,
+		Error:    scanErr,
+		Stderr:   stderr,
+		Created:  int(time.Now().Unix()),
+	}})
+	return nil
+}
+
+func (m *memoryStore) ResolveScanErrors(repo, sha string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.scanErrors {
+		if e.Repo == repo && e.SHA == sha {
+			e.resolved = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) GetScanErrors() ([]ScanError, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []ScanError
+	for i := len(m.scanErrors) - 1; i >= 0; i-- {
+		if !m.scanErrors[i].resolved {
+			errs = append(errs, m.scanErrors[i].ScanError)
+		}
+	}
+	return errs, nil
+}
+
+func (m *memoryStore) InsertHoneytoken(hash, location, owner string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := Honeytoken{ID: m.nextID(), Hash: hash, Location: location, Owner: owner, Created: int(time.Now().Unix())}
+	m.honeytokens = append(m.honeytokens, t)
+	return t.ID, nil
+}
+
+func (m *memoryStore) DeleteHoneytoken(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.honeytokens {
+		if t.ID == id {
+			m.honeytokens = append(m.honeytokens[:i], m.honeytokens[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no honeytoken with id %d", id)
+}
+
+func (m *memoryStore) GetHoneytokens() ([]Honeytoken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Honeytoken(nil), m.honeytokens...), nil
+}
+
+func (m *memoryStore) InsertKnownSecret(hash, name, owner string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := KnownSecret{ID: m.nextID(), Hash: hash, Name: name, Owner: owner, Created: int(time.Now().Unix())}
+	m.knownSecrets = append(m.knownSecrets, s)
+	return s.ID, nil
+}
+
+func (m *memoryStore) DeleteKnownSecret(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.knownSecrets {
+		if s.ID == id {
+			m.knownSecrets = append(m.knownSecrets[:i], m.knownSecrets[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no known secret with id %d", id)
+}
+
+func (m *memoryStore) GetKnownSecrets() ([]KnownSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]KnownSecret(nil), m.knownSecrets...), nil
+}
+
+func (m *memoryStore) InsertAPIToken(name, hash string, scopes []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.apiTokens {
+		if t.Hash == hash {
+			return 0, fmt.Errorf("an API token with this hash already exists")
+		}
+	}
+	t := APIToken{ID: m.nextID(), Name: name, Hash: hash, Scopes: append([]string(nil), scopes...), Created: int(time.Now().Unix())}
+	m.apiTokens = append(m.apiTokens, t)
+	return t.ID, nil
+}
+
+func (m *memoryStore) GetAPIToken(hash string) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.apiTokens {
+		if t.Hash == hash && !t.Revoked {
+			c := t
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) RevokeAPIToken(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.apiTokens {
+		if t.ID == id && !t.Revoked {
+			m.apiTokens[i].Revoked = true
+			return nil
+		}
+	}
+	return fmt.Errorf("no active API token with id %d", id)
+}
+
+func (m *memoryStore) GetAPITokens() ([]APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]APIToken(nil), m.apiTokens...), nil
+}
+
+// pageBounds returns the bounds of the page of a list of n items, like OFFSET and LIMIT
+func pageBounds(n, offset, limit int) (start, end int) {
+	start = offset
+	if start > n || start < 0 {
+		start = n
+	}
+	end = n
+	if limit > 0 && start+limit < n {
+		end = start + limit
+	}
+	return start, end
+}
+
+func containsInt(values []int, v int) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
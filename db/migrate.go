@@ -0,0 +1,196 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The migrations are named <version>_<name>.sql, and applied in the order of their version
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the key of the advisory lock held while migrating, so that
+// processes starting at the same time don't apply the same migration twice
+const migrationLock = 0x6c6f6273746572 // "lobster"
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations, ordered by version
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || version <= 0 {
+			return nil, fmt.Errorf("invalid migration name: %s", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: parts[1], sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version: %d", migrations[i].version)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations in order, each one in its own transaction,
+// and returns the version of the schema. Only a postgres database has a schema to migrate.
+func Migrate() (int, error) {
+	p, ok := store.(*postgresStore)
+	if !ok {
+		return 0, fmt.Errorf("no postgres database to migrate")
+	}
+
+	err := p.createSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range migrations {
+		applied, err := p.applyMigration(m)
+		if err != nil {
+			return 0, fmt.Errorf("migration %d_%s failed: %s", m.version, m.name, err)
+		}
+		if applied {
+			log.WithFields(log.Fields{"version": m.version, "name": m.name}).Info("Migration applied")
+		}
+	}
+
+	return p.schemaVersion()
+}
+
+// SchemaVersion returns the version of the last migration applied, 0 if none was
+func SchemaVersion() (int, error) {
+	p, ok := store.(*postgresStore)
+	if !ok {
+		return 0, fmt.Errorf("no postgres database to migrate")
+	}
+	return p.schemaVersion()
+}
+
+func (p *postgresStore) schemaVersion() (int, error) {
+	err := p.createSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	err = p.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// CheckSchema returns an error if some migrations haven't been applied yet.
+// There is nothing to check when no postgres database is used.
+func CheckSchema() error {
+	p, ok := store.(*postgresStore)
+	if !ok {
+		return nil
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	version, err := p.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; version < latest {
+		return fmt.Errorf("the database schema is at version %d instead of %d, run \"lobster-pot migrate\"", version, latest)
+	}
+	return nil
+}
+
+func (p *postgresStore) createSchemaVersion() error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version
+    (
+        version int PRIMARY KEY,
+		name character varying(100) NOT NULL,
+		applied int NOT NULL
+    )
+	WITH (OIDS=FALSE);`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyMigration applies a migration and records it, unless it was already applied.
+// It returns true if the migration was applied.
+func (p *postgresStore) applyMigration(m migration) (bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock)
+	if err != nil {
+		return false, err
+	}
+
+	count := 0
+	err = tx.QueryRow("SELECT COUNT(*) FROM schema_version WHERE version=$1", m.version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	// without arguments, the statements of the file are sent at once
+	_, err = tx.Exec(m.sql)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version(version, name, applied) VALUES ($1,$2,$3)",
+		m.version, m.name, int(time.Now().Unix()))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
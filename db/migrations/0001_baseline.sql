@@ -0,0 +1,159 @@
+-- Tables created before the schema was versioned. Every statement is idempotent,
+-- so the migration can be applied on the databases created by the previous versions.
+
+CREATE TABLE IF NOT EXISTS scans
+(
+	uid serial NOT NULL,
+	commit character varying(40) NOT NULL,
+	fid character varying(64) NOT NULL,
+	repo character varying(100) NOT NULL,
+	filepath character varying(255) NOT NULL,
+	status int,
+	updated int
+)
+WITH (OIDS=FALSE);
+
+-- result of the last verification of the secret: live, revoked or unknown
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS verification character varying(20);
+-- date at which a triage decision stops applying, NULL if it never expires
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS expires int;
+-- level of the finding reported by the scanner, used to pick its SLA policy
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS level character varying(20);
+
+CREATE TABLE IF NOT EXISTS commits
+(
+	uid serial NOT NULL,
+	sha character varying(40) NOT NULL,
+	repo character varying(100) NOT NULL,
+	files int,
+	findings int,
+	date int
+)
+WITH (OIDS=FALSE);
+
+CREATE TABLE IF NOT EXISTS slackMessages
+(
+	uid serial NOT NULL,
+	fid character varying(64) NOT NULL,
+	msgid character varying(255) NOT NULL,
+	sentat int
+)
+WITH (OIDS=FALSE);
+
+CREATE TABLE IF NOT EXISTS checkRuns
+(
+	uid serial NOT NULL,
+	checkid bigint NOT NULL,
+	repo character varying(100) NOT NULL,
+	sha character varying(40) NOT NULL,
+	conclusion character varying(20),
+	updated int
+)
+WITH (OIDS=FALSE);
+
+CREATE TABLE IF NOT EXISTS checkRunFindings
+(
+	uid serial NOT NULL,
+	checkid bigint NOT NULL,
+	fid character varying(64) NOT NULL
+)
+WITH (OIDS=FALSE);
+
+CREATE TABLE IF NOT EXISTS jobs
+(
+	uid serial PRIMARY KEY,
+	delivery character varying(64) NOT NULL UNIQUE,
+	event character varying(50) NOT NULL,
+	payload bytea NOT NULL,
+	status character varying(20) NOT NULL,
+	attempts int NOT NULL DEFAULT 0,
+	runat int NOT NULL,
+	lasterror text,
+	updated int
+)
+WITH (OIDS=FALSE);
+
+CREATE TABLE IF NOT EXISTS slackOutbox
+(
+	uid serial PRIMARY KEY,
+	fid character varying(64) NOT NULL,
+	appid character varying(50) NOT NULL,
+	message text NOT NULL,
+	status character varying(20) NOT NULL,
+	attempts int NOT NULL DEFAULT 0,
+	runat int NOT NULL,
+	lasterror text,
+	created int,
+	updated int
+)
+WITH (OIDS=FALSE);
+
+-- messages posted to another channel than the app's, such as the honeytoken alerts
+ALTER TABLE slackOutbox ADD COLUMN IF NOT EXISTS channel character varying(50) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS scanErrors
+(
+	uid serial PRIMARY KEY,
+	repo character varying(100) NOT NULL,
+	sha character varying(40) NOT NULL,
+	scanner character varying(50) NOT NULL,
+	timedout boolean NOT NULL DEFAULT false,
+	error text NOT NULL,
+	stderr text,
+	resolved boolean NOT NULL DEFAULT false,
+	created int
+)
+WITH (OIDS=FALSE);
+
+-- salted hashes of real secrets, the plaintext is never stored
+CREATE TABLE IF NOT EXISTS knownSecrets
+(
+	uid serial PRIMARY KEY,
+	hash character varying(64) NOT NULL UNIQUE,
+	name character varying(100) NOT NULL,
+	owner character varying(100) NOT NULL,
+	created int
+)
+WITH (OIDS=FALSE);
+
+-- canary credentials planted to detect leaks, only their salted hash is stored
+CREATE TABLE IF NOT EXISTS honeytokens
+(
+	uid serial PRIMARY KEY,
+	hash character varying(64) NOT NULL UNIQUE,
+	location text NOT NULL,
+	owner character varying(100) NOT NULL,
+	created int
+)
+WITH (OIDS=FALSE);
+
+-- history of the status changes of the findings, for audit purposes
+CREATE TABLE IF NOT EXISTS finding_events
+(
+	uid serial PRIMARY KEY,
+	fid character varying(64) NOT NULL,
+	actor character varying(100) NOT NULL,
+	actorname character varying(100) NOT NULL,
+	source character varying(20) NOT NULL,
+	oldstatus int,
+	newstatus int NOT NULL,
+	comment text,
+	created int NOT NULL
+)
+WITH (OIDS=FALSE);
+
+-- the history is append-only: updates and deletes are silently ignored
+CREATE INDEX IF NOT EXISTS finding_events_fid ON finding_events (fid);
+CREATE OR REPLACE RULE finding_events_no_update AS ON UPDATE TO finding_events DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE finding_events_no_delete AS ON DELETE TO finding_events DO INSTEAD NOTHING;
+
+-- reminders posted for the findings waiting for triage, since is when the finding became untriaged
+CREATE TABLE IF NOT EXISTS findingReminders
+(
+	fid character varying(64) PRIMARY KEY,
+	since int NOT NULL,
+	reminders int NOT NULL DEFAULT 0,
+	lastreminder int NOT NULL,
+	escalated int NOT NULL DEFAULT 0
+)
+WITH (OIDS=FALSE);
@@ -0,0 +1,18 @@
+-- Primary keys of the first tables, and indexes on the columns used to look rows up.
+-- The fids are looked up with "=" rather than "LIKE", so the btree indexes are used whatever the collation.
+
+ALTER TABLE commits ADD PRIMARY KEY (uid);
+ALTER TABLE slackMessages ADD PRIMARY KEY (uid);
+ALTER TABLE checkRuns ADD PRIMARY KEY (uid);
+ALTER TABLE checkRunFindings ADD PRIMARY KEY (uid);
+
+CREATE INDEX commits_sha_repo ON commits (sha, repo);
+CREATE INDEX slackMessages_fid ON slackMessages (fid);
+CREATE INDEX slackMessages_msgid ON slackMessages (msgid);
+CREATE INDEX checkRuns_checkid ON checkRuns (checkid);
+CREATE INDEX checkRunFindings_checkid ON checkRunFindings (checkid);
+CREATE INDEX checkRunFindings_fid ON checkRunFindings (fid);
+CREATE INDEX jobs_status_runat ON jobs (status, runat);
+CREATE INDEX slackOutbox_appid_status ON slackOutbox (appid, status, runat);
+CREATE INDEX slackOutbox_fid ON slackOutbox (fid);
+CREATE INDEX scanErrors_repo_sha ON scanErrors (repo, sha);
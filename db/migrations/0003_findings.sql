@@ -0,0 +1,55 @@
+-- The scans table is replaced by the findings table, with one row per finding, and the occurrences table,
+-- with one row per sighting of a finding in a commit.
+
+CREATE TABLE findings
+(
+	fid character varying(64) PRIMARY KEY,
+	repo character varying(100) NOT NULL,
+	path text NOT NULL,
+	ruleid character varying(100) NOT NULL DEFAULT '',
+	description text NOT NULL DEFAULT '',
+	severity character varying(20) NOT NULL DEFAULT '',
+	scanner character varying(100) NOT NULL DEFAULT '',
+	status int NOT NULL,
+	verification character varying(20),
+	expires int,
+	firstseen int NOT NULL,
+	lastseen int NOT NULL,
+	updated int NOT NULL
+)
+WITH (OIDS=FALSE);
+
+CREATE INDEX findings_repo_path ON findings (repo, path);
+CREATE INDEX findings_status ON findings (status);
+
+CREATE TABLE occurrences
+(
+	uid serial PRIMARY KEY,
+	fid character varying(64) NOT NULL,
+	sha character varying(40) NOT NULL,
+	line character varying(20) NOT NULL DEFAULT '',
+	pusher character varying(100) NOT NULL DEFAULT '',
+	seen int NOT NULL,
+	UNIQUE (fid, sha, line)
+)
+WITH (OIDS=FALSE);
+
+CREATE INDEX occurrences_sha ON occurrences (sha);
+
+-- the rule, line and scanner of the existing findings weren't stored. They were first seen
+-- at their creation event if they have one, else at their last update.
+INSERT INTO findings (fid, repo, path, severity, status, verification, expires, firstseen, lastseen, updated)
+SELECT DISTINCT ON (s.fid) s.fid, s.repo, s.filepath, COALESCE(s.level, ''), COALESCE(s.status, 0), s.verification, s.expires,
+	COALESCE((SELECT MIN(e.created) FROM finding_events e WHERE e.fid = s.fid), s.updated, 0),
+	COALESCE(s.updated, 0), COALESCE(s.updated, 0)
+FROM scans s
+ORDER BY s.fid, s.uid;
+
+-- scans only kept the commit in which a finding was first seen
+INSERT INTO occurrences (fid, sha, seen)
+SELECT DISTINCT ON (s.fid, s.commit) s.fid, s.commit, COALESCE(s.updated, 0)
+FROM scans s
+ORDER BY s.fid, s.commit, s.uid;
+
+-- the scans table is kept until the migrated findings have been checked, a later migration drops it
+ALTER TABLE scans RENAME TO scans_legacy;
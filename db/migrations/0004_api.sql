@@ -0,0 +1,16 @@
+-- Tokens of the REST API. Only the sha256 of a token is stored, the token itself is shown once at its creation.
+
+CREATE TABLE apiTokens
+(
+	uid serial PRIMARY KEY,
+	name character varying(100) NOT NULL,
+	hash character varying(64) NOT NULL UNIQUE,
+	scopes character varying(255) NOT NULL,
+	revoked boolean NOT NULL DEFAULT false,
+	created int NOT NULL
+)
+WITH (OIDS=FALSE);
+
+-- the findings and commits are listed by date
+CREATE INDEX findings_firstseen ON findings (firstseen);
+CREATE INDEX commits_date ON commits (date);
@@ -0,0 +1,6 @@
+-- The honeytoken alerts are posted before the messages queued earlier, see OUTBOX_PRIORITY_ALERT
+
+ALTER TABLE slackOutbox ADD COLUMN priority int NOT NULL DEFAULT 0;
+
+DROP INDEX slackOutbox_appid_status;
+CREATE INDEX slackOutbox_appid_status ON slackOutbox (appid, status, priority DESC, uid);
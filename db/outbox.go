@@ -0,0 +1,233 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Outbox message states
+const (
+	OUTBOX_PENDING = "pending"
+	OUTBOX_SENDING = "sending"
+	OUTBOX_SENT    = "sent"
+	OUTBOX_DEAD    = "dead"
+)
+
+// Outbox message priorities, the messages of a higher priority are posted first
+const (
+	OUTBOX_PRIORITY_NORMAL = 0
+	OUTBOX_PRIORITY_ALERT  = 1 // honeytoken alerts, which can't wait behind the findings of a large push
+)
+
+// OutboxLease is how long a message can stay in the sending state before it is
+// considered abandoned by a crashed process and can be claimed again
+const OutboxLease = 5 * time.Minute
+
+// OutboxMessage is a Slack message waiting to be posted
+type OutboxMessage struct {
+	ID        int
+	FID       string
+	AppID     string
+	Channel   string // channel to post to, the app's channel if empty
+	Message   string // JSON encoded slack.Message
+	Priority  int
+	Status    string
+	Attempts  int
+	LastError string
+	Created   int
+}
+
+// InsertOutboxMessage adds a message to the Slack outbox, to be posted as soon as possible, after the
+// messages of a higher priority. The message is posted to the app's channel if channel is empty.
+func InsertOutboxMessage(fid, appID, channel, message string, priority int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertOutboxMessage(fid, appID, channel, message, priority)
+}
+
+func (p *postgresStore) InsertOutboxMessage(fid, appID, channel, message string, priority int) error {
+	stmt, err := p.db.Prepare(`INSERT INTO slackOutbox(fid,appid,channel,message,status,attempts,runat,created,updated,priority)
+		VALUES ($1,$2,$3,$4,$5,0,$6,$6,$6,$7)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(fid, appID, channel, message, OUTBOX_PENDING, now, priority)
+	return err
+}
+
+// ClaimOutboxMessage marks the oldest message of the highest priority due for the Slack app as being sent,
+// and returns it. It returns nil if no message is waiting.
+func ClaimOutboxMessage(appID string) (*OutboxMessage, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.ClaimOutboxMessage(appID)
+}
+
+func (p *postgresStore) ClaimOutboxMessage(appID string) (*OutboxMessage, error) {
+	now := int(time.Now().Unix())
+	expired := int(time.Now().Add(-OutboxLease).Unix())
+
+	var m OutboxMessage
+	e := p.db.QueryRow(`UPDATE slackOutbox SET status=$1, updated=$2
+		WHERE uid = (
+			SELECT uid FROM slackOutbox
+			WHERE appid=$3 AND ((status=$4 AND runat <= $2) OR (status=$1 AND updated < $5))
+			ORDER BY priority DESC, uid
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING uid, fid, appid, channel, message, priority, status, attempts, created`,
+		OUTBOX_SENDING, now, appID, OUTBOX_PENDING, expired).Scan(&m.ID, &m.FID, &m.AppID, &m.Channel, &m.Message, &m.Priority, &m.Status, &m.Attempts, &m.Created)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &m, nil
+}
+
+// MarkOutboxMessageSent marks a message as successfully posted
+func MarkOutboxMessageSent(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.MarkOutboxMessageSent(id)
+}
+
+func (p *postgresStore) MarkOutboxMessageSent(id int) error {
+	return p.updateOutboxMessage("UPDATE slackOutbox SET status=$1, lasterror=NULL, updated=$2 WHERE uid=$3",
+		OUTBOX_SENT, int(time.Now().Unix()), id)
+}
+
+// PostponeOutboxMessage puts a message back in the outbox without counting a failed attempt,
+// used when Slack rate limits the app
+func PostponeOutboxMessage(id int, runAt time.Time) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.PostponeOutboxMessage(id, runAt)
+}
+
+func (p *postgresStore) PostponeOutboxMessage(id int, runAt time.Time) error {
+	return p.updateOutboxMessage("UPDATE slackOutbox SET status=$1, runat=$2, updated=$3 WHERE uid=$4",
+		OUTBOX_PENDING, int(runAt.Unix()), int(time.Now().Unix()), id)
+}
+
+// RetryOutboxMessage records a failed attempt, and puts the message back in the outbox to be sent at runAt
+func RetryOutboxMessage(id int, sendErr error, runAt time.Time) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.RetryOutboxMessage(id, sendErr, runAt)
+}
+
+func (p *postgresStore) RetryOutboxMessage(id int, sendErr error, runAt time.Time) error {
+	return p.updateOutboxMessage("UPDATE slackOutbox SET status=$1, attempts=attempts+1, lasterror=$2, runat=$3, updated=$4 WHERE uid=$5",
+		OUTBOX_PENDING, sendErr.Error(), int(runAt.Unix()), int(time.Now().Unix()), id)
+}
+
+// KillOutboxMessage moves a message that can't be sent to the dead-letter state
+func KillOutboxMessage(id int, sendErr error) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.KillOutboxMessage(id, sendErr)
+}
+
+func (p *postgresStore) KillOutboxMessage(id int, sendErr error) error {
+	return p.updateOutboxMessage("UPDATE slackOutbox SET status=$1, attempts=attempts+1, lasterror=$2, updated=$3 WHERE uid=$4",
+		OUTBOX_DEAD, sendErr.Error(), int(time.Now().Unix()), id)
+}
+
+// ReplayOutboxMessage puts a dead message back in the outbox, with a fresh count of attempts
+func ReplayOutboxMessage(id int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.ReplayOutboxMessage(id)
+}
+
+func (p *postgresStore) ReplayOutboxMessage(id int) error {
+	now := int(time.Now().Unix())
+	res, err := p.db.Exec("UPDATE slackOutbox SET status=$1, attempts=0, runat=$2, updated=$2 WHERE uid=$3 AND status=$4",
+		OUTBOX_PENDING, now, id, OUTBOX_DEAD)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no dead message with id %d", id)
+	}
+	return nil
+}
+
+// GetDeadOutboxMessages returns the messages in the dead-letter state
+func GetDeadOutboxMessages() ([]OutboxMessage, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetDeadOutboxMessages()
+}
+
+func (p *postgresStore) GetDeadOutboxMessages() ([]OutboxMessage, error) {
+	rows, err := p.db.Query(`SELECT uid, fid, appid, channel, message, status, attempts, COALESCE(lasterror, ''), created
+		FROM slackOutbox WHERE status=$1 ORDER BY uid`, OUTBOX_DEAD)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		err := rows.Scan(&m.ID, &m.FID, &m.AppID, &m.Channel, &m.Message, &m.Status, &m.Attempts, &m.LastError, &m.Created)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// GetSentOutboxMessage returns the last message posted to the app's channel for a finding,
+// or an empty string if none was posted. The replies posted in the thread of the message, such as
+// the reminders, are skipped.
+func GetSentOutboxMessage(fid string) (string, error) {
+	if store == nil {
+		return "", errNotInitialized
+	}
+	return store.GetSentOutboxMessage(fid)
+}
+
+func (p *postgresStore) GetSentOutboxMessage(fid string) (string, error) {
+	var message string
+	e := p.db.QueryRow("SELECT message FROM slackOutbox WHERE fid=$1 AND channel='' AND status=$2 AND COALESCE(message::json->>'thread_ts', '')='' ORDER BY uid DESC LIMIT 1",
+		fid, OUTBOX_SENT).Scan(&message)
+	if e == sql.ErrNoRows {
+		return "", nil
+	}
+	return message, e
+}
+
+func (p *postgresStore) updateOutboxMessage(query string, args ...interface{}) error {
+	stmt, err := p.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(args...)
+	return err
+}
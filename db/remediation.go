@@ -0,0 +1,35 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+// GetOpenFileFindings returns the fids of the findings of a file that are still to be remediated:
+// the untriaged ones, and the verified ones that haven't been removed from the repository yet.
+// False positives and known safe findings are left out.
+func GetOpenFileFindings(repo, filepath string) ([]string, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetOpenFileFindings(repo, filepath)
+}
+
+func (p *postgresStore) GetOpenFileFindings(repo, filepath string) ([]string, error) {
+	rows, err := p.db.Query(`SELECT fid FROM findings WHERE repo=$1 AND path=$2 AND status IN ($3,$4,$5,$6,$7)`,
+		repo, filepath, NEW_FINDING, REPEAT_FINDING, VERIFIED_POSITIVE, ROTATION_PENDING, ROTATED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fids []string
+	for rows.Next() {
+		var fid string
+		err = rows.Scan(&fid)
+		if err != nil {
+			return nil, err
+		}
+		fids = append(fids, fid)
+	}
+	return fids, rows.Err()
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+// UntriagedFinding is a finding waiting for triage, with the reminders posted since it is
+type UntriagedFinding struct {
+	FID          string
+	Repo         string
+	Level        string
+	Since        int // when the finding became untriaged: it was created, reopened, or seen again after being triaged or removed
+	Reminders    int
+	LastReminder int
+	Escalated    int    // when the finding was escalated, 0 if it wasn't
+	MessageTS    string // first slack message posted for the finding, empty if none was
+
+	// state of the reminders as stored, to only record a reminder once when several processes send them
+	storedSince        int
+	storedLastReminder int
+}
+
+// GetUntriagedFindings returns the findings waiting for triage. The reminders posted before
+// the finding last became untriaged are not counted.
+func GetUntriagedFindings() ([]UntriagedFinding, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetUntriagedFindings()
+}
+
+func (p *postgresStore) GetUntriagedFindings() ([]UntriagedFinding, error) {
+	rows, err := p.db.Query(`SELECT s.fid, s.repo, s.severity,
+			COALESCE((SELECT MAX(e.created) FROM finding_events e WHERE e.fid = s.fid AND e.newstatus IN ($1, $2)
+				AND (e.oldstatus IS NULL OR e.oldstatus NOT IN ($1, $2))), s.firstseen),
+			COALESCE(r.since, 0), COALESCE(r.reminders, 0), COALESCE(r.lastreminder, 0), COALESCE(r.escalated, 0),
+			COALESCE((SELECT m.msgid FROM slackMessages m WHERE m.fid = s.fid ORDER BY m.sentat, m.uid LIMIT 1), '')
+		FROM findings s
+		LEFT JOIN findingReminders r ON r.fid = s.fid
+		WHERE s.status IN ($1, $2)`, NEW_FINDING, REPEAT_FINDING)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []UntriagedFinding
+	for rows.Next() {
+		var f UntriagedFinding
+		err = rows.Scan(&f.FID, &f.Repo, &f.Level, &f.Since, &f.storedSince, &f.Reminders, &f.storedLastReminder, &f.Escalated, &f.MessageTS)
+		if err != nil {
+			return nil, err
+		}
+		f.LastReminder = f.storedLastReminder
+		if f.storedSince != f.Since {
+			f.Reminders, f.LastReminder, f.Escalated = 0, 0, 0
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// RecordReminder records a reminder of a finding, and its escalation if escalated is true.
+// It returns false if another process recorded a reminder since f was read, in which case
+// this one must not be posted.
+func RecordReminder(f UntriagedFinding, now int, escalated bool) (bool, error) {
+	if store == nil {
+		return false, errNotInitialized
+	}
+	return store.RecordReminder(f, now, escalated)
+}
+
+func (p *postgresStore) RecordReminder(f UntriagedFinding, now int, escalated bool) (bool, error) {
+	escalatedAt := f.Escalated
+	if escalated {
+		escalatedAt = now
+	}
+
+	res, err := p.db.Exec(`INSERT INTO findingReminders(fid, since, reminders, lastreminder, escalated) VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (fid) DO UPDATE SET since=$2, reminders=$3, lastreminder=$4, escalated=$5
+		WHERE findingReminders.since=$6 AND findingReminders.lastreminder=$7`,
+		f.FID, f.Since, f.Reminders+1, now, escalatedAt, f.storedSince, f.storedLastReminder)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
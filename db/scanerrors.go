@@ -0,0 +1,82 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"time"
+)
+
+// ScanError is the failure of a scanner on a commit
+type ScanError struct {
+	ID       int
+	Repo     string
+	SHA      string
+	Scanner  string
+	TimedOut bool
+	Error    string
+	Stderr   string // end of the scanner's stderr, if any
+	Created  int
+}
+
+// InsertScanError saves the failure of a scanner on a commit
+func InsertScanError(repo, sha, scanner string, timedOut bool, scanErr, stderr string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.InsertScanError(repo, sha, scanner, timedOut, scanErr, stderr)
+}
+
+func (p *postgresStore) InsertScanError(repo, sha, scanner string, timedOut bool, scanErr, stderr string) error {
+	stmt, err := p.db.Prepare(`INSERT INTO scanErrors(repo,sha,scanner,timedout,error,stderr,resolved,created)
+		VALUES ($1,$2,$3,$4,$5,$6,false,$7)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := int(time.Now().Unix())
+	_, err = stmt.Exec(repo, sha, scanner, timedOut, scanErr, stderr, now)
+	return err
+}
+
+// ResolveScanErrors marks the failures of a commit as resolved, once the commit has been scanned successfully
+func ResolveScanErrors(repo, sha string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.ResolveScanErrors(repo, sha)
+}
+
+func (p *postgresStore) ResolveScanErrors(repo, sha string) error {
+	_, err := p.db.Exec("UPDATE scanErrors SET resolved=true WHERE repo=$1 AND sha=$2 AND resolved=false", repo, sha)
+	return err
+}
+
+// GetScanErrors returns the unresolved scan failures, the most recent first
+func GetScanErrors() ([]ScanError, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetScanErrors()
+}
+
+func (p *postgresStore) GetScanErrors() ([]ScanError, error) {
+	rows, err := p.db.Query(`SELECT uid, repo, sha, scanner, timedout, error, COALESCE(stderr, ''), created
+		FROM scanErrors WHERE resolved=false ORDER BY uid DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var errs []ScanError
+	for rows.Next() {
+		var e ScanError
+		err = rows.Scan(&e.ID, &e.Repo, &e.SHA, &e.Scanner, &e.TimedOut, &e.Error, &e.Stderr, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, e)
+	}
+	return errs, rows.Err()
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store is the storage of lobster-pot. The functions of the package use the store set with Connect or SetStore.
+type Store interface {
+	// findings and their history
+	InsertFinding(f Finding) (int, error)
+	SelectFinding(fid string) (state int, updated int, err error)
+	GetFinding(fid string) (*Finding, error)
+	SetFindingStatus(fid string, status int, actor Actor, comment string) (int, error)
+	TriageFinding(fid string, status, expires int, actor Actor, comment string) (int, error)
+	UpdateFindingVerification(fid, verification string) error
+	GetFindingHistory(fid string) ([]FindingEvent, error)
+	InsertOccurrence(o Occurrence) error
+	GetOccurrences(fid string) ([]Occurrence, error)
+	GetOpenFileFindings(repo, filepath string) ([]string, error)
+	GetExpiredFindings(now time.Time) ([]ExpiredFinding, error)
+	ExpireFinding(fid string) (bool, error)
+	GetUntriagedFindings() ([]UntriagedFinding, error)
+	RecordReminder(f UntriagedFinding, now int, escalated bool) (bool, error)
+	ListFindings(filter FindingFilter) ([]Finding, error)
+
+	// commits
+	InsertCommitScan(commit, repo string, totalFiles, findings int) error
+	IsCommitScanned(commit, repo string) (bool, error)
+	ListCommitScans(filter CommitFilter) ([]CommitScan, error)
+
+	// slack messages
+	InsertSlackMessage(fid, msgid string) error
+	GetSlackMessageFid(msgid string) (string, error)
+	GetSlackMessagesFromFid(fid string) ([]string, error)
+	InsertOutboxMessage(fid, appID, channel, message string, priority int) error
+	ClaimOutboxMessage(appID string) (*OutboxMessage, error)
+	MarkOutboxMessageSent(id int) error
+	PostponeOutboxMessage(id int, runAt time.Time) error
+	RetryOutboxMessage(id int, sendErr error, runAt time.Time) error
+	KillOutboxMessage(id int, sendErr error) error
+	ReplayOutboxMessage(id int) error
+	GetDeadOutboxMessages() ([]OutboxMessage, error)
+	GetSentOutboxMessage(fid string) (string, error)
+
+	// check runs
+	InsertCheckRun(checkID int64, repo, sha, conclusion string, fids []string) error
+	GetCheckRunsFromFid(fid string) ([]CheckRun, error)
+	CountUntriagedCheckRunFindings(checkID int64) (int, error)
+	UpdateCheckRunConclusion(checkID int64, conclusion string) error
+
+	// webhook jobs
+	InsertJob(delivery, event string, payload []byte) error
+	ClaimJob() (*Job, error)
+	RenewJob(id int) error
+	CompleteJob(id int) error
+	RetryJob(id int, jobErr error, runAt time.Time) error
+	KillJob(id int, jobErr error) error
+
+	// scan errors
+	InsertScanError(repo, sha, scanner string, timedOut bool, scanErr, stderr string) error
+	ResolveScanErrors(repo, sha string) error
+	GetScanErrors() ([]ScanError, error)
+
+	// registries of the honeytokens and known secrets
+	InsertHoneytoken(hash, location, owner string) (int, error)
+	DeleteHoneytoken(id int) error
+	GetHoneytokens() ([]Honeytoken, error)
+	InsertKnownSecret(hash, name, owner string) (int, error)
+	DeleteKnownSecret(id int) error
+	GetKnownSecrets() ([]KnownSecret, error)
+
+	// tokens of the REST API
+	InsertAPIToken(name, hash string, scopes []string) (int, error)
+	GetAPIToken(hash string) (*APIToken, error)
+	RevokeAPIToken(id int) error
+	GetAPITokens() ([]APIToken, error)
+}
+
+// store is nil until Connect or SetStore is called
+var store Store
+
+var errNotInitialized = fmt.Errorf("database not initialized")
+
+// SetStore sets the store used by the functions of the package, such as an in-memory store for local development
+func SetStore(s Store) {
+	store = s
+}
@@ -0,0 +1,447 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+var testActor = Actor{ID: "U024BE7LH", Name: "jdoe", Source: SOURCE_SLACK}
+
+// insertTestFinding inserts a finding in the store, failing the test on error
+func insertTestFinding(t *testing.T, s Store, f Finding) {
+	t.Helper()
+	if _, err := s.InsertFinding(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testTables are emptied before each test run against postgres
+var testTables = []string{"findings", "occurrences", "finding_events", "findingReminders", "slackMessages", "slackOutbox",
+	"checkRuns", "checkRunFindings", "commits", "jobs", "scanErrors", "knownSecrets", "honeytokens", "apiTokens"}
+
+// forEachStore runs the test against the in-memory store, and against the postgres database
+// of TEST_DATABASE_URL when it is set. The database is migrated and emptied before the run.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newTestPostgresStore(t))
+	})
+}
+
+// newTestPostgresStore returns the store of the test database, skipping the test if there is none
+func newTestPostgresStore(t *testing.T) Store {
+	t.Helper()
+	dburl := os.Getenv("TEST_DATABASE_URL")
+	if dburl == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	// Connect and Migrate work on the store of the package
+	previous := store
+	defer SetStore(previous)
+	if err := Connect(dburl); err != nil {
+		t.Fatal(err)
+	}
+	p := store.(*postgresStore)
+	t.Cleanup(func() { p.db.Close() })
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range testTables {
+		if _, err := p.db.Exec("TRUNCATE " + table + " RESTART IDENTITY"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+// setFirstSeen sets when all the findings of the store were first seen
+func setFirstSeen(t *testing.T, s Store, firstSeen int) {
+	t.Helper()
+	switch s := s.(type) {
+	case *memoryStore:
+		for _, f := range s.findings {
+			f.FirstSeen = firstSeen
+		}
+	case *postgresStore:
+		if _, err := s.db.Exec("UPDATE findings SET firstseen=$1", firstSeen); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// backdateFinding moves the creation and the history of a finding to the given date.
+// The updates of the history are ignored by a rule of the database, disabled for the update.
+func backdateFinding(t *testing.T, s Store, fid string, created int) {
+	t.Helper()
+	switch s := s.(type) {
+	case *memoryStore:
+		s.findings[fid].FirstSeen = created
+		for i := range s.events {
+			if s.events[i].FID == fid {
+				s.events[i].Created = created
+			}
+		}
+	case *postgresStore:
+		tx, err := s.db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE findings SET firstseen=$1 WHERE fid=$2", created, fid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("ALTER TABLE finding_events DISABLE RULE finding_events_no_update"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("UPDATE finding_events SET created=$1 WHERE fid=$2", created, fid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("ALTER TABLE finding_events ENABLE RULE finding_events_no_update"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoreInsertFindingRepeat(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		f := Finding{FID: "fid1", Repo: "acme/api", Path: "/config.yml", RuleID: "aws-key"}
+
+		status, err := s.InsertFinding(f)
+		if err != nil || status != NEW_FINDING {
+			t.Fatalf("first insert = %d, %v, want NEW_FINDING", status, err)
+		}
+
+		// a finding seen again before being triaged is a repeat
+		status, err = s.InsertFinding(f)
+		if err != nil || status != REPEAT_FINDING {
+			t.Fatalf("second insert = %d, %v, want REPEAT_FINDING", status, err)
+		}
+
+		// a triaged finding keeps its status
+		if _, err := s.SetFindingStatus("fid1", FALSE_POSITIVE, testActor, "test fixture"); err != nil {
+			t.Fatal(err)
+		}
+		status, err = s.InsertFinding(f)
+		if err != nil || status != FALSE_POSITIVE {
+			t.Fatalf("insert of a triaged finding = %d, %v, want FALSE_POSITIVE", status, err)
+		}
+	})
+}
+
+func TestStoreSetFindingStatusHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		insertTestFinding(t, s, Finding{FID: "fid1", Repo: "acme/api"})
+
+		if _, err := s.SetFindingStatus("fid1", KNOWN_SAFE, testActor, "test fixture"); err != nil {
+			t.Fatal(err)
+		}
+		// setting the same status again isn't a change
+		if _, err := s.SetFindingStatus("fid1", KNOWN_SAFE, ScanActor, ""); err != nil {
+			t.Fatal(err)
+		}
+		// unless a reason is given, the decision is confirmed
+		if _, err := s.SetFindingStatus("fid1", KNOWN_SAFE, testActor, "still a test account"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.SetFindingStatus("missing", KNOWN_SAFE, testActor, ""); err == nil {
+			t.Error("status of a missing finding set")
+		}
+
+		events, err := s.GetFindingHistory("fid1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 3 {
+			t.Fatalf("history = %+v, want the creation, the change and its confirmation", events)
+		}
+		if e := events[0]; e.Actor != ScanActor || e.OldStatus != -1 || e.NewStatus != NEW_FINDING {
+			t.Errorf("creation event = %+v", e)
+		}
+		if e := events[1]; e.Actor != testActor || e.OldStatus != NEW_FINDING || e.NewStatus != KNOWN_SAFE || e.Comment != "test fixture" {
+			t.Errorf("status change event = %+v", e)
+		}
+		if e := events[2]; e.Actor != testActor || e.OldStatus != KNOWN_SAFE || e.NewStatus != KNOWN_SAFE || e.Comment != "still a test account" {
+			t.Errorf("confirmation event = %+v", e)
+		}
+	})
+}
+
+func TestStoreExpireFinding(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now()
+		insertTestFinding(t, s, Finding{FID: "expired", Repo: "acme/api"})
+		insertTestFinding(t, s, Finding{FID: "future", Repo: "acme/api"})
+		for fid, expires := range map[string]time.Time{"expired": now.Add(-time.Hour), "future": now.Add(time.Hour)} {
+			if _, err := s.TriageFinding(fid, KNOWN_SAFE, int(expires.Unix()), testActor, "until the migration"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expired, err := s.GetExpiredFindings(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expired) != 1 || expired[0].FID != "expired" || expired[0].Status != KNOWN_SAFE {
+			t.Fatalf("expired findings = %+v", expired)
+		}
+
+		if ok, err := s.ExpireFinding("future"); err != nil || ok {
+			t.Errorf("finding expiring in the future expired: %v, %v", ok, err)
+		}
+		if ok, err := s.ExpireFinding("expired"); err != nil || !ok {
+			t.Fatalf("expired finding not expired: %v, %v", ok, err)
+		}
+		// the finding is only reopened once, by the job or the scan that sees it first
+		if ok, err := s.ExpireFinding("expired"); err != nil || ok {
+			t.Errorf("finding expired twice: %v, %v", ok, err)
+		}
+
+		f, err := s.GetFinding("expired")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Status != NEW_FINDING || f.Expires != 0 {
+			t.Errorf("expired finding = %+v, want a new finding without expiry", f)
+		}
+		events, err := s.GetFindingHistory("expired")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := events[len(events)-1]; e.Actor != ExpiryActor || e.OldStatus != KNOWN_SAFE || e.NewStatus != NEW_FINDING {
+			t.Errorf("expiry event = %+v", e)
+		}
+	})
+}
+
+func TestStoreTriageFinding(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		insertTestFinding(t, s, Finding{FID: "fid1", Repo: "acme/api"})
+		expires := int(time.Now().Add(24 * time.Hour).Unix())
+
+		if _, err := s.TriageFinding("fid1", FALSE_POSITIVE, expires, testActor, "test fixture"); err != nil {
+			t.Fatal(err)
+		}
+		f, err := s.GetFinding("fid1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Status != FALSE_POSITIVE || f.Expires != expires {
+			t.Errorf("triaged finding = %+v, want FALSE_POSITIVE until %d", f, expires)
+		}
+
+		// extending the exception is recorded, even without a reason
+		if _, err := s.TriageFinding("fid1", FALSE_POSITIVE, expires+3600, testActor, ""); err != nil {
+			t.Fatal(err)
+		}
+		// and making it permanent clears the expiry
+		if _, err := s.TriageFinding("fid1", FALSE_POSITIVE, 0, testActor, ""); err != nil {
+			t.Fatal(err)
+		}
+		if f, _ := s.GetFinding("fid1"); f.Expires != 0 {
+			t.Errorf("expiry = %d, want none", f.Expires)
+		}
+		events, err := s.GetFindingHistory("fid1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 4 {
+			t.Errorf("history = %+v, want the creation, the decision and the two expiry changes", events)
+		}
+	})
+}
+
+func TestStoreRecordReminder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		insertTestFinding(t, s, Finding{FID: "fid1", Repo: "acme/api", Severity: "high"})
+
+		// two processes reading the untriaged findings at the same time
+		first, err := s.GetUntriagedFindings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := s.GetUntriagedFindings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first) != 1 || len(second) != 1 {
+			t.Fatalf("untriaged findings = %+v", first)
+		}
+
+		now := int(time.Now().Unix())
+		if ok, err := s.RecordReminder(first[0], now, false); err != nil || !ok {
+			t.Fatalf("first reminder not recorded: %v, %v", ok, err)
+		}
+		// only one of them sends the reminder
+		if ok, err := s.RecordReminder(second[0], now, false); err != nil || ok {
+			t.Errorf("reminder recorded from a stale read: %v, %v", ok, err)
+		}
+
+		untriaged, err := s.GetUntriagedFindings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := untriaged[0]; f.Reminders != 1 || f.LastReminder != now || f.Escalated != 0 {
+			t.Errorf("untriaged finding after a reminder = %+v", f)
+		}
+
+		// a fresh read can record the next reminder
+		if ok, err := s.RecordReminder(untriaged[0], now+60, true); err != nil || !ok {
+			t.Fatalf("escalation not recorded: %v, %v", ok, err)
+		}
+		untriaged, err = s.GetUntriagedFindings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := untriaged[0]; f.Reminders != 2 || f.Escalated != now+60 {
+			t.Errorf("untriaged finding after an escalation = %+v", f)
+		}
+	})
+}
+
+func TestStoreUntriagedSince(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		insertTestFinding(t, s, Finding{FID: "fid1", Repo: "acme/api"})
+		monthsAgo := int(time.Now().Add(-90 * 24 * time.Hour).Unix())
+
+		// seen again, then removed from the default branch months ago
+		for _, status := range []int{REPEAT_FINDING, REMOVED_FROM_HEAD} {
+			if _, err := s.SetFindingStatus("fid1", status, ScanActor, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		backdateFinding(t, s, "fid1", monthsAgo)
+
+		now := int(time.Now().Unix())
+		if _, err := s.SetFindingStatus("fid1", REPEAT_FINDING, ScanActor, ""); err != nil {
+			t.Fatal(err)
+		}
+		untriaged, err := s.GetUntriagedFindings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the wait starts when the secret was added back, not when it was first seen
+		if len(untriaged) != 1 || untriaged[0].Since < now {
+			t.Errorf("untriaged findings = %+v, want the finding waiting since it was added back", untriaged)
+		}
+	})
+}
+
+func TestStoreListFindings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		insertTestFinding(t, s, Finding{FID: "a", Repo: "acme/api", RuleID: "aws-key", Scanner: "golang"})
+		insertTestFinding(t, s, Finding{FID: "b", Repo: "acme/web", RuleID: "slack-token", Scanner: "golang,gitleaks"})
+		insertTestFinding(t, s, Finding{FID: "c", Repo: "other/api", RuleID: "aws-key", Scanner: "trufflehog"})
+		insertTestFinding(t, s, Finding{FID: "d", Repo: "acme/api", RuleID: "aws-key", Scanner: "gitleaks"})
+		if _, err := s.SetFindingStatus("d", FALSE_POSITIVE, testActor, "test fixture"); err != nil {
+			t.Fatal(err)
+		}
+		// seen in the same second, so they are listed by fid
+		setFirstSeen(t, s, int(time.Now().Unix()))
+
+		tests := []struct {
+			name   string
+			filter FindingFilter
+			want   []string
+		}{
+			{name: "all", filter: FindingFilter{}, want: []string{"a", "b", "c", "d"}},
+			{name: "org", filter: FindingFilter{Org: "acme"}, want: []string{"a", "b", "d"}},
+			{name: "org in another case", filter: FindingFilter{Org: "ACME"}, want: []string{"a", "b", "d"}},
+			{name: "repo", filter: FindingFilter{Repo: "acme/api"}, want: []string{"a", "d"}},
+			{name: "statuses", filter: FindingFilter{Statuses: []int{NEW_FINDING, REPEAT_FINDING}}, want: []string{"a", "b", "c"}},
+			{name: "scanner", filter: FindingFilter{Scanner: "gitleaks"}, want: []string{"b", "d"}},
+			{name: "rule", filter: FindingFilter{RuleID: "aws-key", Org: "acme"}, want: []string{"a", "d"}},
+			{name: "since", filter: FindingFilter{Since: int(time.Now().Add(time.Hour).Unix())}, want: nil},
+			{name: "until", filter: FindingFilter{Until: int(time.Now().Add(time.Hour).Unix())}, want: []string{"a", "b", "c", "d"}},
+			{name: "first page", filter: FindingFilter{Limit: 3}, want: []string{"a", "b", "c"}},
+			{name: "last page", filter: FindingFilter{Limit: 3, Offset: 3}, want: []string{"d"}},
+			{name: "past the end", filter: FindingFilter{Limit: 3, Offset: 10}, want: nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				findings, err := s.ListFindings(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, f := range findings {
+					got = append(got, f.FID)
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("fids = %v, want %v", got, tt.want)
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Fatalf("fids = %v, want %v", got, tt.want)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestStoreGetSentOutboxMessage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		send := func(message string) {
+			t.Helper()
+			if err := s.InsertOutboxMessage("fid1", "A02A8JQ6W5R", "", message, OUTBOX_PRIORITY_NORMAL); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := s.ClaimOutboxMessage("A02A8JQ6W5R")
+			if err != nil || msg == nil {
+				t.Fatalf("claimed %+v, %v", msg, err)
+			}
+			if err := s.MarkOutboxMessageSent(msg.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		send(`{"type":"message","text":"finding"}`)
+		// the reminders are posted in the thread of the message
+		send(`{"type":"message","text":"reminder","thread_ts":"1656590481.452889"}`)
+
+		m, err := s.GetSentOutboxMessage("fid1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != `{"type":"message","text":"finding"}` {
+			t.Errorf("sent message = %s, want the message of the finding", m)
+		}
+	})
+}
+
+func TestStoreClaimOutboxMessagePriority(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for _, fid := range []string{"fid1", "fid2"} {
+			if err := s.InsertOutboxMessage(fid, "A02A8JQ6W5R", "", `{"type":"message"}`, OUTBOX_PRIORITY_NORMAL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.InsertOutboxMessage("honeytoken", "A02A8JQ6W5R", "C0ALERTS00", `{"type":"message"}`, OUTBOX_PRIORITY_ALERT); err != nil {
+			t.Fatal(err)
+		}
+
+		// the alert queued last is posted first, then the messages in order
+		for _, want := range []string{"honeytoken", "fid1", "fid2"} {
+			msg, err := s.ClaimOutboxMessage("A02A8JQ6W5R")
+			if err != nil || msg == nil {
+				t.Fatalf("claimed %+v, %v", msg, err)
+			}
+			if msg.FID != want {
+				t.Errorf("claimed %s, want %s", msg.FID, want)
+			}
+		}
+	})
+}
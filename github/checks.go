@@ -0,0 +1,119 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package gh
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// CheckRunName is the name of the check run displayed on pull requests
+const CheckRunName = "lobster-pot"
+
+// GitHub only accepts 50 annotations per check run create or update request
+const maxAnnotationsPerRequest = 50
+
+// CreateCheckRun creates a new in_progress check run on the given commit and returns its ID
+func CreateCheckRun(authRepo GithubRepo, sha string) (int64, error) {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	opts := github.CreateCheckRunOptions{
+		Name:      CheckRunName,
+		HeadSHA:   sha,
+		Status:    github.String("in_progress"),
+		StartedAt: &github.Timestamp{Time: time.Now()},
+	}
+	cr, _, err := gh.Checks.CreateCheckRun(authRepo.Ctx, ow, re, opts)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"event":  "createCheckRun",
+			"repo":   re,
+			"owner":  ow,
+			"commit": sha,
+			"error":  err,
+		}).Error("Could not create check run")
+		return 0, err
+	}
+	return cr.GetID(), nil
+}
+
+// CompleteCheckRun marks a check run as completed with the given conclusion.
+// Annotations are sent in batches, since GitHub limits the number of annotations per request.
+func CompleteCheckRun(authRepo GithubRepo, checkRunID int64, conclusion, title, summary string, annotations []*github.CheckRunAnnotation) error {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	for {
+		batch := annotations
+		if len(batch) > maxAnnotationsPerRequest {
+			batch = annotations[:maxAnnotationsPerRequest]
+		}
+		annotations = annotations[len(batch):]
+
+		opts := github.UpdateCheckRunOptions{
+			Name: CheckRunName,
+			Output: &github.CheckRunOutput{
+				Title:       github.String(title),
+				Summary:     github.String(summary),
+				Annotations: batch,
+			},
+		}
+		// only complete the run with the last batch, so it isn't displayed as done
+		// while annotations are still being added
+		if len(annotations) == 0 {
+			opts.Status = github.String("completed")
+			opts.Conclusion = github.String(conclusion)
+			opts.CompletedAt = &github.Timestamp{Time: time.Now()}
+		}
+
+		_, _, err := gh.Checks.UpdateCheckRun(authRepo.Ctx, ow, re, checkRunID, opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event":      "completeCheckRun",
+				"repo":       re,
+				"owner":      ow,
+				"checkRunID": checkRunID,
+				"error":      err,
+			}).Error("Could not update check run")
+			return err
+		}
+
+		if len(annotations) == 0 {
+			return nil
+		}
+	}
+}
+
+// ListPullRequestFiles returns all the files changed by a pull request
+func ListPullRequestFiles(authRepo GithubRepo, number int) ([]*github.CommitFile, error) {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	var files []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		f, resp, err := gh.PullRequests.ListFiles(authRepo.Ctx, ow, re, number, opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event":       "listPullRequestFiles",
+				"repo":        re,
+				"owner":       ow,
+				"pullRequest": number,
+				"error":       err,
+			}).Error("Could not list pull request files")
+			return nil, err
+		}
+		files = append(files, f...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return files, nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package gh
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// AddedLines maps the path of each file changed by a commit to the set of lines the commit added.
+// A file without a patch (binary or too large for GitHub to diff) maps to nil.
+type AddedLines map[string]map[int]bool
+
+// DeletedLines maps the path of each file changed by a commit to the set of lines the commit deleted,
+// numbered as in the previous version of the file. A file without a patch maps to nil.
+type DeletedLines map[string]map[int]bool
+
+// hunkHeader matches the header of a unified diff hunk, ex: @@ -10,7 +10,8 @@
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// NewAddedLines builds the added lines of a list of changed files from their patches
+func NewAddedLines(files []*github.CommitFile) AddedLines {
+	a := make(AddedLines)
+	for _, f := range files {
+		if f.Patch == nil {
+			a[f.GetFilename()] = nil
+			continue
+		}
+		a[f.GetFilename()], _ = parsePatch(f.GetPatch())
+	}
+	return a
+}
+
+// NewDeletedLines builds the deleted lines of a list of changed files from their patches
+func NewDeletedLines(files []*github.CommitFile) DeletedLines {
+	d := make(DeletedLines)
+	for _, f := range files {
+		if f.Patch == nil {
+			d[f.GetFilename()] = nil
+			continue
+		}
+		_, d[f.GetFilename()] = parsePatch(f.GetPatch())
+	}
+	return d
+}
+
+// IsDeleted returns true if one of the lines between start and end, in the previous version of the file,
+// was deleted by the commit. When the commit's patch for the file is unknown, no line is known to be deleted.
+func (d DeletedLines) IsDeleted(path string, start, end int) bool {
+	lines := d[strings.TrimPrefix(path, "/")]
+	for l := start; l <= end; l++ {
+		if lines[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPreExisting returns true if none of the lines between start and end were added by the commit.
+// When the commit's patch for the file is unknown, the finding can't be proven to be pre-existing.
+func (a AddedLines) IsPreExisting(path string, start, end int) bool {
+	lines, ok := a[strings.TrimPrefix(path, "/")]
+	if !ok || lines == nil {
+		return false
+	}
+	for l := start; l <= end; l++ {
+		if lines[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePatch returns the line numbers of the lines added by the patch, in the new version of the file,
+// and of the lines deleted by the patch, in the previous version
+func parsePatch(patch string) (added, deleted map[int]bool) {
+	added = make(map[int]bool)
+	deleted = make(map[int]bool)
+	oldLine, line := 0, 0
+	for _, l := range strings.Split(patch, "\n") {
+		if m := hunkHeader.FindStringSubmatch(l); m != nil {
+			oldLine, _ = strconv.Atoi(m[1])
+			line, _ = strconv.Atoi(m[2])
+			continue
+		}
+		if line == 0 && oldLine == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "+"):
+			added[line] = true
+			line++
+		case strings.HasPrefix(l, "-"):
+			// removed lines don't exist in the new version
+			deleted[oldLine] = true
+			oldLine++
+		case strings.HasPrefix(l, "\\"):
+			// "\ No newline at end of file" isn't a line of either version
+		default:
+			oldLine++
+			line++
+		}
+	}
+	return added, deleted
+}
+
+// GetCommitFiles returns the files changed by a commit, along with their patches
+func GetCommitFiles(authRepo GithubRepo, sha string) ([]*github.CommitFile, error) {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	var files []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		c, resp, err := gh.Repositories.GetCommit(authRepo.Ctx, ow, re, sha, opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event":  "getCommitFiles",
+				"repo":   re,
+				"owner":  ow,
+				"commit": sha,
+				"error":  err,
+			}).Error("Could not get commit")
+			return nil, err
+		}
+		files = append(files, c.Files...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return files, nil
+}
+
+// CompareCommits returns the SHAs of the commits reachable from head and not from base,
+// oldest first. For a force push, base doesn't need to be an ancestor of head: the commits
+// are listed from the merge base of the two.
+func CompareCommits(authRepo GithubRepo, base, head string) ([]string, error) {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	var shas []string
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		cmp, resp, err := gh.Repositories.CompareCommits(authRepo.Ctx, ow, re, base, head, opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event": "compareCommits",
+				"repo":  re,
+				"owner": ow,
+				"base":  base,
+				"head":  head,
+				"error": err,
+			}).Error("Could not compare commits")
+			return nil, err
+		}
+		for _, c := range cmp.Commits {
+			shas = append(shas, c.GetSHA())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return shas, nil
+}
+
+// ListCommits returns the SHAs of all the commits reachable from head, oldest first.
+// It is used when there is no base to compare head with, such as a newly created default branch.
+func ListCommits(authRepo GithubRepo, head string) ([]string, error) {
+	gh := authRepo.Client
+	ow, re := authRepo.Owner, authRepo.Repo
+
+	var shas []string
+	opts := &github.CommitsListOptions{SHA: head, ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		commits, resp, err := gh.Repositories.ListCommits(authRepo.Ctx, ow, re, opts)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event": "listCommits",
+				"repo":  re,
+				"owner": ow,
+				"head":  head,
+				"error": err,
+			}).Error("Could not list commits")
+			return nil, err
+		}
+		for _, c := range commits {
+			shas = append(shas, c.GetSHA())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	// the commits are listed newest first
+	for i, j := 0, len(shas)-1; i < j; i, j = i+1, j-1 {
+		shas[i], shas[j] = shas[j], shas[i]
+	}
+	return shas, nil
+}
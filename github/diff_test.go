@@ -0,0 +1,134 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package gh
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+)
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		added   map[int]bool
+		deleted map[int]bool
+	}{
+		{
+			name:    "new file",
+			patch:   "@@ -0,0 +1,3 @@\n+a\n+b\n+c",
+			added:   map[int]bool{1: true, 2: true, 3: true},
+			deleted: map[int]bool{},
+		},
+		{
+			name:    "deleted file",
+			patch:   "@@ -1,2 +0,0 @@\n-a\n-b",
+			added:   map[int]bool{},
+			deleted: map[int]bool{1: true, 2: true},
+		},
+		{
+			name:    "hunk offset",
+			patch:   "@@ -10,3 +10,4 @@ func main() {\n context\n+added\n context\n context",
+			added:   map[int]bool{11: true},
+			deleted: map[int]bool{},
+		},
+		{
+			name:    "deleted lines",
+			patch:   "@@ -5,4 +5,3 @@\n context\n-removed\n-removed\n+replaced\n context",
+			added:   map[int]bool{6: true},
+			deleted: map[int]bool{6: true, 7: true},
+		},
+		{
+			name:    "only deleted lines",
+			patch:   "@@ -5,3 +5,1 @@\n context\n-removed\n-removed",
+			added:   map[int]bool{},
+			deleted: map[int]bool{6: true, 7: true},
+		},
+		{
+			name: "multiple hunks",
+			patch: "@@ -1,2 +1,3 @@\n+header\n a\n b\n" +
+				"@@ -100,3 +101,3 @@\n x\n-old\n+new\n y",
+			added:   map[int]bool{1: true, 102: true},
+			deleted: map[int]bool{101: true},
+		},
+		{
+			name:    "no newline at end of file",
+			patch:   "@@ -1,1 +1,2 @@\n-last\n\\ No newline at end of file\n+last\n+appended",
+			added:   map[int]bool{1: true, 2: true},
+			deleted: map[int]bool{1: true},
+		},
+		{
+			name:    "single line hunk",
+			patch:   "@@ -7 +7 @@\n-old\n+new",
+			added:   map[int]bool{7: true},
+			deleted: map[int]bool{7: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, deleted := parsePatch(tt.patch)
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added = %v, want %v", added, tt.added)
+			}
+			if !reflect.DeepEqual(deleted, tt.deleted) {
+				t.Errorf("deleted = %v, want %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestIsPreExisting(t *testing.T) {
+	a := NewAddedLines([]*github.CommitFile{
+		{Filename: github.String("config.yml"), Patch: github.String("@@ -10,3 +10,4 @@\n a\n+added\n b\n c")},
+		{Filename: github.String("key.p12")},
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		start, end int
+		want       bool
+	}{
+		{name: "added line", path: "/config.yml", start: 11, end: 11, want: false},
+		{name: "untouched line", path: "/config.yml", start: 12, end: 12, want: true},
+		{name: "range over an added line", path: "/config.yml", start: 9, end: 11, want: false},
+		{name: "range of untouched lines", path: "/config.yml", start: 1, end: 10, want: true},
+		{name: "file without patch", path: "/key.p12", start: 1, end: 1, want: false},
+		{name: "file not in the commit", path: "/other.yml", start: 1, end: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.IsPreExisting(tt.path, tt.start, tt.end); got != tt.want {
+				t.Errorf("IsPreExisting(%q, %d, %d) = %v, want %v", tt.path, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+
+	// a nil AddedLines, outside of diff mode, never reports a finding as pre-existing
+	if AddedLines(nil).IsPreExisting("/config.yml", 12, 12) {
+		t.Error("pre-existing finding outside of diff mode")
+	}
+}
+
+func TestIsDeleted(t *testing.T) {
+	d := NewDeletedLines([]*github.CommitFile{
+		{Filename: github.String("config.yml"), Patch: github.String("@@ -10,3 +10,2 @@\n a\n-password: hunter2\n b")},
+		{Filename: github.String("key.p12")},
+	})
+
+	if !d.IsDeleted("/config.yml", 11, 11) {
+		t.Error("deleted line not reported")
+	}
+	if d.IsDeleted("/config.yml", 12, 14) {
+		t.Error("untouched lines reported as deleted")
+	}
+	if d.IsDeleted("/key.p12", 1, 1) || d.IsDeleted("/other.yml", 1, 1) {
+		t.Error("lines of a file without patch reported as deleted")
+	}
+}
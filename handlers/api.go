@@ -0,0 +1,560 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - api
+// Contains the REST API used to query and triage the findings, authenticated with scoped tokens
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scopes of the API tokens
+const (
+	ScopeFindingsRead  = "findings:read"
+	ScopeFindingsWrite = "findings:write"
+	ScopeCommitsRead   = "commits:read"
+)
+
+// APIScopes are the scopes an API token can be granted
+var APIScopes = []string{ScopeFindingsRead, ScopeFindingsWrite, ScopeCommitsRead}
+
+const apiTokenPrefix = "lpt_"
+
+var apiDefaultLimit = 100 // page size when the limit isn't set
+var apiMaxLimit = 500     // largest page size
+var apiMaxBody = 64 << 10 // largest request body, in bytes
+
+// apiTokenName is what the token names can be made of, since they are shown in Slack
+var apiTokenName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+
+// apiStatuses are the statuses of the findings, by name
+var apiStatuses = map[string]int{
+	"NEW_FINDING":       db.NEW_FINDING,
+	"FALSE_POSITIVE":    db.FALSE_POSITIVE,
+	"KNOWN_SAFE":        db.KNOWN_SAFE,
+	"VERIFIED_POSITIVE": db.VERIFIED_POSITIVE,
+	"REPEAT_FINDING":    db.REPEAT_FINDING,
+	"ROTATION_PENDING":  db.ROTATION_PENDING,
+	"ROTATED":           db.ROTATED,
+	"REMOVED_FROM_HEAD": db.REMOVED_FROM_HEAD,
+}
+
+// apiTriageStatuses are the statuses a finding can be set to through the API, the same as from Slack.
+// The repeats and the removals are only detected by the scans.
+var apiTriageStatuses = map[int]bool{
+	db.NEW_FINDING:       true,
+	db.FALSE_POSITIVE:    true,
+	db.KNOWN_SAFE:        true,
+	db.VERIFIED_POSITIVE: true,
+	db.ROTATION_PENDING:  true,
+	db.ROTATED:           true,
+}
+
+type apiFinding struct {
+	FID          string   `json:"fid"`
+	Repo         string   `json:"repo"`
+	Path         string   `json:"path"`
+	RuleID       string   `json:"rule_id"`
+	Description  string   `json:"description"`
+	Severity     string   `json:"severity,omitempty"`
+	Scanners     []string `json:"scanners"`
+	Status       string   `json:"status"`
+	Verification string   `json:"verification,omitempty"`
+	Expires      string   `json:"expires,omitempty"`
+	FirstSeen    string   `json:"first_seen"`
+	LastSeen     string   `json:"last_seen"`
+	Updated      string   `json:"updated"`
+}
+
+type apiFindingDetails struct {
+	apiFinding
+	History     []apiEvent      `json:"history"`
+	Occurrences []apiOccurrence `json:"occurrences"`
+}
+
+type apiEvent struct {
+	Actor     apiActor `json:"actor"`
+	OldStatus string   `json:"old_status,omitempty"`
+	NewStatus string   `json:"new_status"`
+	Comment   string   `json:"comment,omitempty"`
+	Created   string   `json:"created"`
+}
+
+type apiActor struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+type apiOccurrence struct {
+	SHA    string `json:"sha"`
+	Line   string `json:"line"`
+	Pusher string `json:"pusher,omitempty"`
+	Seen   string `json:"seen"`
+}
+
+type apiCommitScan struct {
+	SHA       string `json:"sha"`
+	Repo      string `json:"repo"`
+	Files     int    `json:"files"`
+	Findings  int    `json:"findings"`
+	ScannedAt string `json:"scanned_at"`
+}
+
+// apiStatusUpdate is the body of a status update
+type apiStatusUpdate struct {
+	Status        string `json:"status"`
+	Justification string `json:"justification"`
+	Expires       string `json:"expires"` // date or RFC3339 time, only for FALSE_POSITIVE and KNOWN_SAFE
+}
+
+// apiHandlerFunc handles a request authenticated with token
+type apiHandlerFunc func(w http.ResponseWriter, r *http.Request, token *db.APIToken)
+
+// NewAPIToken generates a new API token, and returns it along with its hash
+func NewAPIToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	token = apiTokenPrefix + hex.EncodeToString(b)
+	return token, hashAPIToken(token), nil
+}
+
+// ValidateAPIToken checks the name and scopes of a new API token
+func ValidateAPIToken(name string, scopes []string) error {
+	if !apiTokenName.MatchString(name) {
+		return fmt.Errorf("invalid token name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required: %s", strings.Join(APIScopes, ", "))
+	}
+	for _, s := range scopes {
+		valid := false
+		for _, v := range APIScopes {
+			valid = valid || s == v
+		}
+		if !valid {
+			return fmt.Errorf("invalid scope %q, the scopes are: %s", s, strings.Join(APIScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// hashAPIToken returns the sha256 of a token. The tokens are random, so they don't need a salt.
+func hashAPIToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// APIHandler returns the handler of the REST API, served under /api/v1/
+func APIHandler(c config.Config) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1/findings", apiAuth(http.MethodGet, ScopeFindingsRead, listFindings))
+
+	mux.HandleFunc("/api/v1/findings/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/findings/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] != "":
+			apiAuth(http.MethodGet, ScopeFindingsRead, func(w http.ResponseWriter, r *http.Request, _ *db.APIToken) {
+				writeFindingDetails(w, parts[0])
+			})(w, r)
+		case len(parts) == 2 && parts[0] != "" && parts[1] == "status":
+			apiAuth(http.MethodPost, ScopeFindingsWrite, func(w http.ResponseWriter, r *http.Request, t *db.APIToken) {
+				updateFindingStatus(w, r, t, parts[0], c)
+			})(w, r)
+		default:
+			writeAPIError(w, http.StatusNotFound, "not found")
+		}
+	})
+
+	mux.HandleFunc("/api/v1/commits", apiAuth(http.MethodGet, ScopeCommitsRead, listCommitScans))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+	})
+	return mux
+}
+
+// apiAuth checks the method of the request and its bearer token, which must have the scope, before calling next
+func apiAuth(method, scope string, next apiHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		bearer := r.Header.Get("Authorization")
+		if !strings.HasPrefix(bearer, "Bearer ") {
+			writeAPIError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		token, err := db.GetAPIToken(hashAPIToken(strings.TrimPrefix(bearer, "Bearer ")))
+		if err != nil {
+			log.Error("Could not read the API token ", err)
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if token == nil {
+			writeAPIError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if !token.HasScope(scope) {
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("the token doesn't have the %s scope", scope))
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"event":  "api",
+			"token":  token.Name,
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Info()
+		next(w, r, token)
+	}
+}
+
+// listFindings lists the findings, filtered by org, repo, status, scanner, rule and first seen date
+func listFindings(w http.ResponseWriter, r *http.Request, _ *db.APIToken) {
+	q := r.URL.Query()
+	filter := db.FindingFilter{
+		Org:     q.Get("org"),
+		Repo:    apiRepo(q.Get("org"), q.Get("repo")),
+		Scanner: q.Get("scanner"),
+		RuleID:  q.Get("rule"),
+	}
+
+	if s := q.Get("status"); s != "" {
+		for _, name := range strings.Split(s, ",") {
+			status, ok := apiStatuses[strings.ToUpper(strings.TrimSpace(name))]
+			if !ok {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q", name))
+				return
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+	filter.Since, filter.Until, err = apiDateRange(q.Get("since"), q.Get("until"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := apiPage(q.Get("limit"), q.Get("offset"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// one more finding tells whether there is a next page
+	filter.Limit, filter.Offset = limit+1, offset
+
+	findings, err := db.ListFindings(filter)
+	if err != nil {
+		log.Error("Could not list the findings ", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := struct {
+		Findings   []apiFinding `json:"findings"`
+		NextOffset int          `json:"next_offset,omitempty"`
+	}{Findings: []apiFinding{}}
+	if len(findings) > limit {
+		findings = findings[:limit]
+		resp.NextOffset = offset + limit
+	}
+	for _, f := range findings {
+		resp.Findings = append(resp.Findings, newAPIFinding(f))
+	}
+	writeAPIResponse(w, http.StatusOK, resp)
+}
+
+// writeFindingDetails writes a finding, with its history and occurrences
+func writeFindingDetails(w http.ResponseWriter, fid string) {
+	f, err := db.GetFinding(fid)
+	if err == nil && f == nil {
+		writeAPIError(w, http.StatusNotFound, "finding not found")
+		return
+	}
+	var events []db.FindingEvent
+	if err == nil {
+		events, err = db.GetFindingHistory(fid)
+	}
+	var occurrences []db.Occurrence
+	if err == nil {
+		occurrences, err = db.GetOccurrences(fid)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not read the finding ", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	details := apiFindingDetails{apiFinding: newAPIFinding(*f), History: []apiEvent{}, Occurrences: []apiOccurrence{}}
+	for _, e := range events {
+		event := apiEvent{Actor: apiActor(e.Actor), NewStatus: apiStatusName(e.NewStatus), Comment: e.Comment, Created: apiTime(e.Created)}
+		if e.OldStatus >= 0 {
+			event.OldStatus = apiStatusName(e.OldStatus)
+		}
+		details.History = append(details.History, event)
+	}
+	for _, o := range occurrences {
+		details.Occurrences = append(details.Occurrences, apiOccurrence{SHA: o.SHA, Line: o.Line, Pusher: o.Pusher, Seen: apiTime(o.Seen)})
+	}
+	writeAPIResponse(w, http.StatusOK, details)
+}
+
+// updateFindingStatus sets the status of a finding, with the justification recorded in its history,
+// and updates the slack messages and the check runs of the finding like a triage from Slack
+func updateFindingStatus(w http.ResponseWriter, r *http.Request, t *db.APIToken, fid string, c config.Config) {
+	var update apiStatusUpdate
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(apiMaxBody)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&update); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	status, ok := apiStatuses[strings.ToUpper(update.Status)]
+	if !ok || !apiTriageStatuses[status] {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q", update.Status))
+		return
+	}
+	justification := strings.TrimSpace(update.Justification)
+	if justification == "" {
+		writeAPIError(w, http.StatusBadRequest, "a justification is required")
+		return
+	}
+
+	// like from Slack, only the exceptions can expire
+	var expires time.Time
+	if update.Expires != "" {
+		if status != db.FALSE_POSITIVE && status != db.KNOWN_SAFE {
+			writeAPIError(w, http.StatusBadRequest, "only the FALSE_POSITIVE and KNOWN_SAFE statuses can expire")
+			return
+		}
+		var err error
+		expires, err = parseAPIDate(update.Expires)
+		if err != nil || !expires.After(time.Now()) {
+			writeAPIError(w, http.StatusBadRequest, "the expiry must be a date in the future")
+			return
+		}
+	}
+
+	l := log.WithFields(log.Fields{"fid": fid, "status": apiStatusName(status), "token": t.Name})
+
+	f, err := db.GetFinding(fid)
+	if err != nil {
+		l.Error(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if f == nil {
+		writeAPIError(w, http.StatusNotFound, "finding not found")
+		return
+	}
+
+	actor := db.Actor{ID: t.Name, Name: t.Name, Source: db.SOURCE_API}
+	var e int
+	if !expires.IsZero() {
+		e = int(expires.Unix())
+	}
+	_, err = db.TriageFinding(fid, status, e, actor, justification)
+	if err != nil {
+		l.Error(err)
+		writeAPIError(w, http.StatusInternalServerError, "the status could not be saved")
+		return
+	}
+	l.Info("Finding status updated through the API")
+
+	owner := strings.SplitN(f.Repo, "/", 2)[0]
+	if app, ok := c.GithubApps[config.GithubOrgName(owner)]; ok {
+		msg := triagedMessage(fid, status, triageDecision(fmt.Sprintf("%s (API)", t.Name), status, justification, expires))
+		updateFindingMessages(fid, msg, app.SlackAppID, c)
+	} else {
+		l.Error("Could not find GitHub App for owner")
+	}
+
+	// pull requests waiting on this finding can be unblocked once everything is triaged
+	refreshCheckRuns(fid, c)
+
+	writeFindingDetails(w, fid)
+}
+
+// listCommitScans lists the scans of the commits, filtered by org, repo and scan date
+func listCommitScans(w http.ResponseWriter, r *http.Request, _ *db.APIToken) {
+	q := r.URL.Query()
+	filter := db.CommitFilter{
+		Org:  q.Get("org"),
+		Repo: apiRepo(q.Get("org"), q.Get("repo")),
+	}
+
+	var err error
+	filter.Since, filter.Until, err = apiDateRange(q.Get("since"), q.Get("until"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := apiPage(q.Get("limit"), q.Get("offset"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Limit, filter.Offset = limit+1, offset
+
+	scans, err := db.ListCommitScans(filter)
+	if err != nil {
+		log.Error("Could not list the commit scans ", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := struct {
+		Commits    []apiCommitScan `json:"commits"`
+		NextOffset int             `json:"next_offset,omitempty"`
+	}{Commits: []apiCommitScan{}}
+	if len(scans) > limit {
+		scans = scans[:limit]
+		resp.NextOffset = offset + limit
+	}
+	for _, s := range scans {
+		resp.Commits = append(resp.Commits, apiCommitScan{SHA: s.SHA, Repo: s.Repo, Files: s.Files, Findings: s.Findings, ScannedAt: apiTime(s.Date)})
+	}
+	writeAPIResponse(w, http.StatusOK, resp)
+}
+
+func newAPIFinding(f db.Finding) apiFinding {
+	a := apiFinding{
+		FID:          f.FID,
+		Repo:         f.Repo,
+		Path:         f.Path,
+		RuleID:       f.RuleID,
+		Description:  f.Description,
+		Severity:     f.Severity,
+		Scanners:     []string{},
+		Status:       apiStatusName(f.Status),
+		Verification: f.Verification,
+		FirstSeen:    apiTime(f.FirstSeen),
+		LastSeen:     apiTime(f.LastSeen),
+		Updated:      apiTime(f.Updated),
+	}
+	if f.Scanner != "" {
+		a.Scanners = strings.Split(f.Scanner, ",")
+	}
+	if f.Expires > 0 {
+		a.Expires = apiTime(f.Expires)
+	}
+	return a
+}
+
+// apiStatusName returns the name of a status, as accepted by the API
+func apiStatusName(status int) string {
+	for name, s := range apiStatuses {
+		if s == status {
+			return name
+		}
+	}
+	return strconv.Itoa(status)
+}
+
+// apiRepo returns the owner/repo of the repo parameter, which can omit the owner when the org is set
+func apiRepo(org, repo string) string {
+	if repo != "" && org != "" && !strings.Contains(repo, "/") {
+		return org + "/" + repo
+	}
+	return repo
+}
+
+// apiDateRange parses the since and until parameters, either of which can be empty.
+// An until date, without time, includes the whole day.
+func apiDateRange(since, until string) (int, int, error) {
+	var s, u int
+	if since != "" {
+		t, err := parseAPIDate(since)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid since %q", since)
+		}
+		s = int(t.Unix())
+	}
+	if until != "" {
+		t, err := parseAPIDate(until)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid until %q", until)
+		}
+		if len(until) == len(apiDateLayout) {
+			t = t.AddDate(0, 0, 1)
+		}
+		u = int(t.Unix())
+	}
+	return s, u, nil
+}
+
+// apiDateLayout is the layout of the dates without time
+const apiDateLayout = "2006-01-02"
+
+// parseAPIDate parses an RFC3339 time, or a date such as 2022-03-01 at midnight UTC
+func parseAPIDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(apiDateLayout, value)
+}
+
+// apiPage parses the limit and offset parameters
+func apiPage(limit, offset string) (int, int, error) {
+	l, o := apiDefaultLimit, 0
+	var err error
+	if limit != "" {
+		l, err = strconv.Atoi(limit)
+		if err != nil || l < 1 || l > apiMaxLimit {
+			return 0, 0, fmt.Errorf("the limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+	if offset != "" {
+		o, err = strconv.Atoi(offset)
+		if err != nil || o < 0 {
+			return 0, 0, fmt.Errorf("the offset must be a positive number")
+		}
+	}
+	return l, o, nil
+}
+
+func apiTime(t int) string {
+	return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	writeAPIResponse(w, code, map[string]string{"error": message})
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(resp); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+)
+
+// apiTestTokens are the tokens of the test API, by name
+type apiTestTokens map[string]string
+
+// newAPITest returns the API handler backed by an in-memory store holding findings of two orgs,
+// and tokens named after their scopes
+func newAPITest(t *testing.T) (http.Handler, apiTestTokens) {
+	t.Helper()
+	db.SetStore(db.NewMemoryStore())
+	t.Cleanup(func() { db.SetStore(nil) })
+
+	tokens := apiTestTokens{}
+	for name, scopes := range map[string][]string{
+		"reader":  {ScopeFindingsRead},
+		"triager": {ScopeFindingsRead, ScopeFindingsWrite},
+		"revoked": {ScopeFindingsRead, ScopeFindingsWrite},
+	} {
+		token, hash, err := NewAPIToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := db.InsertAPIToken(name, hash, scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "revoked" {
+			if err := db.RevokeAPIToken(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tokens[name] = token
+	}
+
+	for _, f := range []db.Finding{
+		{FID: "fid-api-1", Repo: "acme/api", Path: "/config.yml", RuleID: "aws-key", Scanner: "golang"},
+		{FID: "fid-api-2", Repo: "acme/api", Path: "/deploy.sh", RuleID: "github-token", Scanner: "golang,gitleaks"},
+		{FID: "fid-web-1", Repo: "acme/web", Path: "/.env", RuleID: "slack-token", Scanner: "gitleaks"},
+		{FID: "fid-other-1", Repo: "other/api", Path: "/main.go", RuleID: "aws-key", Scanner: "trufflehog"},
+	} {
+		if _, err := db.InsertFinding(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return APIHandler(config.Config{}), tokens
+}
+
+// apiRequest sends a request to the API, with token as bearer token if it isn't empty
+func apiRequest(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeAPIResponse decodes the JSON body of a response
+func decodeAPIResponse(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	h, tokens := newAPITest(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "missing token", method: http.MethodGet, path: "/api/v1/findings", status: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, path: "/api/v1/findings", token: "lpt_unknown", status: http.StatusUnauthorized},
+		{name: "revoked token", method: http.MethodGet, path: "/api/v1/findings", token: tokens["revoked"], status: http.StatusUnauthorized},
+		{name: "missing scope", method: http.MethodGet, path: "/api/v1/commits", token: tokens["triager"], status: http.StatusForbidden},
+		{name: "missing write scope", method: http.MethodPost, path: "/api/v1/findings/fid-api-1/status", token: tokens["reader"], status: http.StatusForbidden},
+		{name: "wrong method", method: http.MethodDelete, path: "/api/v1/findings", token: tokens["reader"], status: http.StatusMethodNotAllowed},
+		{name: "wrong method on status", method: http.MethodGet, path: "/api/v1/findings/fid-api-1/status", token: tokens["triager"], status: http.StatusMethodNotAllowed},
+		{name: "unknown path", method: http.MethodGet, path: "/api/v1/scans", token: tokens["reader"], status: http.StatusNotFound},
+		{name: "valid token", method: http.MethodGet, path: "/api/v1/findings", token: tokens["reader"], status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(h, tt.method, tt.path, tt.token, "")
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+				t.Error("no Allow header")
+			}
+		})
+	}
+}
+
+func TestAPIUpdateStatus(t *testing.T) {
+	h, tokens := newAPITest(t)
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Format("2006-01-02")
+	yesterday := time.Now().Add(-24 * time.Hour).UTC().Format("2006-01-02")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		error  string
+	}{
+		{name: "unknown status", body: `{"status": "FIXED", "justification": "rotated"}`,
+			status: http.StatusBadRequest, error: `invalid status "FIXED"`},
+		{name: "status set by the scans", body: `{"status": "REMOVED_FROM_HEAD", "justification": "deleted"}`,
+			status: http.StatusBadRequest, error: `invalid status "REMOVED_FROM_HEAD"`},
+		{name: "missing justification", body: `{"status": "FALSE_POSITIVE"}`,
+			status: http.StatusBadRequest, error: "a justification is required"},
+		{name: "blank justification", body: `{"status": "FALSE_POSITIVE", "justification": "  "}`,
+			status: http.StatusBadRequest, error: "a justification is required"},
+		{name: "unknown field", body: `{"status": "FALSE_POSITIVE", "justification": "test", "reason": "test"}`,
+			status: http.StatusBadRequest},
+		{name: "expiry of a verified positive", body: fmt.Sprintf(`{"status": "VERIFIED_POSITIVE", "justification": "live", "expires": %q}`, tomorrow),
+			status: http.StatusBadRequest, error: "only the FALSE_POSITIVE and KNOWN_SAFE statuses can expire"},
+		{name: "expiry in the past", body: fmt.Sprintf(`{"status": "KNOWN_SAFE", "justification": "test account", "expires": %q}`, yesterday),
+			status: http.StatusBadRequest, error: "the expiry must be a date in the future"},
+		{name: "invalid expiry", body: `{"status": "KNOWN_SAFE", "justification": "test account", "expires": "next week"}`,
+			status: http.StatusBadRequest, error: "the expiry must be a date in the future"},
+		{name: "known safe until tomorrow", body: fmt.Sprintf(`{"status": "known_safe", "justification": "test account", "expires": %q}`, tomorrow),
+			status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(h, http.MethodPost, "/api/v1/findings/fid-api-1/status", tokens["triager"], tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.error != "" {
+				var resp struct{ Error string }
+				decodeAPIResponse(t, w, &resp)
+				if resp.Error != tt.error {
+					t.Errorf("error = %q, want %q", resp.Error, tt.error)
+				}
+			}
+		})
+	}
+
+	// only the valid update was saved, with the token as actor
+	var details apiFindingDetails
+	decodeAPIResponse(t, apiRequest(h, http.MethodGet, "/api/v1/findings/fid-api-1", tokens["reader"], ""), &details)
+	if details.Status != "KNOWN_SAFE" || !strings.HasPrefix(details.Expires, tomorrow) {
+		t.Errorf("finding = %+v, want KNOWN_SAFE until %s", details.apiFinding, tomorrow)
+	}
+	if len(details.History) != 2 {
+		t.Fatalf("history = %+v, want the creation and the update", details.History)
+	}
+	e := details.History[1]
+	if e.Actor != (apiActor{ID: "triager", Name: "triager", Source: db.SOURCE_API}) || e.OldStatus != "NEW_FINDING" || e.Comment != "test account" {
+		t.Errorf("update event = %+v", e)
+	}
+
+	// confirming the status with a new justification is recorded as well
+	w := apiRequest(h, http.MethodPost, "/api/v1/findings/fid-api-1/status", tokens["triager"], `{"status": "KNOWN_SAFE", "justification": "still a test account"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirmation = %d: %s", w.Code, w.Body.String())
+	}
+	decodeAPIResponse(t, apiRequest(h, http.MethodGet, "/api/v1/findings/fid-api-1", tokens["reader"], ""), &details)
+	if n := len(details.History); n != 3 || details.History[2].Comment != "still a test account" {
+		t.Errorf("history = %+v, want the confirmation recorded", details.History)
+	}
+
+	w = apiRequest(h, http.MethodPost, "/api/v1/findings/missing/status", tokens["triager"], `{"status": "FALSE_POSITIVE", "justification": "test"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("update of a missing finding = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIListFindings(t *testing.T) {
+	h, tokens := newAPITest(t)
+
+	list := func(query string) ([]string, int) {
+		t.Helper()
+		w := apiRequest(h, http.MethodGet, "/api/v1/findings"+query, tokens["reader"], "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Findings   []apiFinding `json:"findings"`
+			NextOffset int          `json:"next_offset"`
+		}
+		decodeAPIResponse(t, w, &resp)
+		var fids []string
+		for _, f := range resp.Findings {
+			fids = append(fids, f.FID)
+		}
+		return fids, resp.NextOffset
+	}
+
+	// the pages follow each other until there is no next offset
+	seen := map[string]bool{}
+	pages := 0
+	for offset := 0; ; pages++ {
+		fids, next := list(fmt.Sprintf("?limit=3&offset=%d", offset))
+		for _, fid := range fids {
+			if seen[fid] {
+				t.Errorf("%s listed twice", fid)
+			}
+			seen[fid] = true
+		}
+		if next == 0 {
+			break
+		}
+		if next != offset+3 {
+			t.Fatalf("next_offset = %d after offset %d", next, offset)
+		}
+		offset = next
+	}
+	if pages != 1 || len(seen) != 4 {
+		t.Errorf("listed %d findings in %d pages, want 4 findings in 2 pages", len(seen), pages+1)
+	}
+	if fids, next := list("?limit=4"); len(fids) != 4 || next != 0 {
+		t.Errorf("full page = %v with next_offset %d", fids, next)
+	}
+
+	// the repo can omit the owner when the org is set
+	for _, query := range []string{"?org=acme&repo=api", "?repo=acme/api"} {
+		fids, _ := list(query)
+		if len(fids) != 2 || strings.HasPrefix(fids[0], "fid-other") || strings.HasPrefix(fids[1], "fid-other") {
+			t.Errorf("%s = %v, want the findings of acme/api", query, fids)
+		}
+	}
+	// a full repo name is kept, and must also match the org
+	if fids, _ := list("?org=other&repo=acme/api"); len(fids) != 0 {
+		t.Errorf("findings of acme/api in other = %v", fids)
+	}
+	// the org is compared without case, as on GitHub
+	for _, query := range []string{"?org=acme", "?org=ACME"} {
+		if fids, _ := list(query); len(fids) != 3 {
+			t.Errorf("%s = %v, want the findings of acme", query, fids)
+		}
+	}
+	// a date includes the whole day
+	today := time.Now().UTC().Format("2006-01-02")
+	if fids, _ := list("?since=" + today + "&until=" + today); len(fids) != 4 {
+		t.Errorf("findings first seen today = %v", fids)
+	}
+	if fids, _ := list("?scanner=gitleaks&status=new_finding"); len(fids) != 2 {
+		t.Errorf("new findings of gitleaks = %v", fids)
+	}
+
+	for _, query := range []string{"?status=FIXED", "?limit=0", "?limit=501", "?offset=-1", "?since=yesterday"} {
+		w := apiRequest(h, http.MethodGet, "/api/v1/findings"+query, tokens["reader"], "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIRepo(t *testing.T) {
+	tests := []struct {
+		org, repo, want string
+	}{
+		{org: "acme", repo: "api", want: "acme/api"},
+		{org: "acme", repo: "other/api", want: "other/api"},
+		{org: "", repo: "api", want: "api"},
+		{org: "acme", repo: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := apiRepo(tt.org, tt.repo); got != tt.want {
+			t.Errorf("apiRepo(%q, %q) = %q, want %q", tt.org, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestAPIDateRange(t *testing.T) {
+	tests := []struct {
+		since, until string
+		wantSince    string
+		wantUntil    string
+	}{
+		{since: "2022-03-01", until: "2022-03-01", wantSince: "2022-03-01T00:00:00Z", wantUntil: "2022-03-02T00:00:00Z"},
+		{since: "2022-03-01T12:00:00Z", until: "2022-03-01T18:30:00+02:00", wantSince: "2022-03-01T12:00:00Z", wantUntil: "2022-03-01T16:30:00Z"},
+		{until: "2022-12-31", wantUntil: "2023-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, u, err := apiDateRange(tt.since, tt.until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []struct {
+			got  int
+			want string
+		}{{s, tt.wantSince}, {u, tt.wantUntil}} {
+			want := 0
+			if c.want != "" {
+				w, _ := time.Parse(time.RFC3339, c.want)
+				want = int(w.Unix())
+			}
+			if c.got != want {
+				t.Errorf("apiDateRange(%q, %q) = %d, %d, want %s, %s", tt.since, tt.until, s, u, tt.wantSince, tt.wantUntil)
+			}
+		}
+	}
+}
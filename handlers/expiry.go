@@ -0,0 +1,84 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - expiry
+// Contains the job reopening the findings whose FALSE_POSITIVE or KNOWN_SAFE exception expired
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	log "github.com/sirupsen/logrus"
+)
+
+var expiryInterval = 10 * time.Minute // how often the expired exceptions are looked for
+
+// StartExpiryJob starts the job reopening the findings whose exception expired.
+// Several processes can run it, a finding is only reopened and notified once.
+func StartExpiryJob(c config.Config) {
+	log.Debug("Starting expiry job")
+	go func() {
+		for {
+			expireFindings(c)
+			time.Sleep(expiryInterval)
+		}
+	}()
+}
+
+func expireFindings(c config.Config) {
+	findings, err := db.GetExpiredFindings(time.Now())
+	if err != nil {
+		log.Error("Could not read the expired findings ", err)
+		return
+	}
+
+	for _, f := range findings {
+		l := log.WithFields(log.Fields{"event": "expireFinding", "fid": f.FID, "repo": f.Repo})
+
+		reopened, err := db.ExpireFinding(f.FID)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		if !reopened {
+			continue
+		}
+		l.Info("Exception expired, finding reopened")
+
+		notifyExpiredFinding(f, c)
+		refreshCheckRuns(f.FID, c)
+	}
+}
+
+// notifyExpiredFinding posts the finding again to the channel of the Slack app of its repository,
+// with the triage buttons, and puts the buttons back on the messages already posted
+func notifyExpiredFinding(f db.ExpiredFinding, c config.Config) {
+	l := log.WithFields(log.Fields{"fid": f.FID, "repo": f.Repo})
+
+	owner := strings.SplitN(f.Repo, "/", 2)[0]
+	app, ok := c.GithubApps[config.GithubOrgName(owner)]
+	if !ok {
+		l.Error("Could not find GitHub App for owner")
+		return
+	}
+
+	msg := triagedMessage(f.FID, db.NEW_FINDING, expiredDecision(f))
+
+	updateFindingMessages(f.FID, msg, app.SlackAppID, c)
+	QueueMessage(f.FID, msg, app.SlackAppID)
+}
+
+// expiredDecision returns the text telling which exception expired, and when
+func expiredDecision(f db.ExpiredFinding) string {
+	exception := "KNOWN_SAFE"
+	if f.Status == db.FALSE_POSITIVE {
+		exception = "FALSE_POSITIVE"
+	}
+	return fmt.Sprintf(":hourglass: The %s exception of this finding expired on %s, it needs to be triaged again",
+		exception, time.Unix(int64(f.Expires), 0).UTC().Format(slackDateLayout))
+}
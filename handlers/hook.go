@@ -10,10 +10,12 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -73,34 +75,31 @@ func GithubWebhookHandler(w http.ResponseWriter, r *http.Request, c config.Confi
 		// If the payload is a push event, validate it against the proper app secret
 		owner := config.GithubOrgName(*e.Repo.Owner.Login)
 		log.Debug("Handling push event for ", owner)
-		app, ok := c.GithubApps[owner]
-		if !ok {
-			log.Error("Could not find app for owner ", owner)
-			w.WriteHeader(http.StatusInternalServerError)
-			_, e := w.Write([]byte("Error!"))
-			if e != nil {
-				log.Error("Could not write to github ", e)
-			}
-			return
-		}
-		if verr := github.ValidateSignature(signature, payload, []byte(app.Secret)); verr != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			_, werr := w.Write([]byte("Signature mismatch!"))
-			if werr != nil {
-				log.Error("Could not write to github ", werr)
-			}
-			log.Error(verr)
+		if !validateWebhook(w, owner, signature, payload, c) {
 			return
 		}
 		// If we're here, the payload is valid, so we can continue
 
 		// can't wait for the scan to finish since large scans will timeout
-		// so send 200 response
-		respstatus = http.StatusOK
-		respbody = []byte("received")
+		// so persist the event for the workers and send 200 response
+		respstatus, respbody = queueJob(r, payload)
 
-		// trigger handler for the event
-		go pushEvent(*e, c)
+	case *github.PullRequestEvent:
+		owner := config.GithubOrgName(*e.Repo.Owner.Login)
+		log.Debug("Handling pull request event for ", owner)
+		if !validateWebhook(w, owner, signature, payload, c) {
+			return
+		}
+
+		// only changes to the code of the pull request need to be scanned
+		switch e.GetAction() {
+		case "opened", "synchronize", "reopened":
+			respstatus, respbody = queueJob(r, payload)
+		default:
+			respstatus = http.StatusOK
+			respbody = []byte("ignored")
+			log.WithFields(log.Fields{"action": e.GetAction()}).Debug("Ignoring pull request action")
+		}
 
 	default:
 		respstatus = http.StatusNotFound
@@ -117,11 +116,47 @@ func GithubWebhookHandler(w http.ResponseWriter, r *http.Request, c config.Confi
 	}
 }
 
+// queueJob persists the webhook in the jobs queue, to be processed by the workers
+func queueJob(r *http.Request, payload []byte) (int, []byte) {
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	err := db.InsertJob(delivery, github.WebHookType(r), payload)
+	if err != nil {
+		// let GitHub know the delivery failed, so it can be redelivered
+		log.WithFields(log.Fields{"Github-Delivery": delivery}).Error("Could not queue job ", err)
+		return http.StatusInternalServerError, []byte("Error!")
+	}
+	return http.StatusOK, []byte("received")
+}
+
+// validateWebhook validates the payload against the secret of the GitHub App configured for the owner.
+// If the payload can't be validated, the error response is written and false is returned.
+func validateWebhook(w http.ResponseWriter, owner config.GithubOrgName, signature string, payload []byte, c config.Config) bool {
+	app, ok := c.GithubApps[owner]
+	if !ok {
+		log.Error("Could not find app for owner ", owner)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, e := w.Write([]byte("Error!"))
+		if e != nil {
+			log.Error("Could not write to github ", e)
+		}
+		return false
+	}
+	if verr := github.ValidateSignature(signature, payload, []byte(app.Secret)); verr != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, werr := w.Write([]byte("Signature mismatch!"))
+		if werr != nil {
+			log.Error("Could not write to github ", werr)
+		}
+		log.Error(verr)
+		return false
+	}
+	return true
+}
+
 func pushEvent(event github.PushEvent, cfg config.Config) (int, []byte, error) {
 	log.Debug("********* Start Handling push event *********")
 	//https://developer.github.com/v3/activity/events/types/#pushevent
 	ref := *event.Ref
-	commits := event.Commits
 	before := *event.Before
 	after := *event.After
 
@@ -166,9 +201,6 @@ func pushEvent(event github.PushEvent, cfg config.Config) (int, []byte, error) {
 		App:   app,
 	}
 
-	// for each commit in push, get files and check if files changed are
-	// ones that we are monitoring for changes
-
 	ghclient, err := gh.NewGithubAuthenticatedClient(app)
 	if err != nil {
 		log.Error("error getting Github authenticated client ", err)
@@ -176,20 +208,106 @@ func pushEvent(event github.PushEvent, cfg config.Config) (int, []byte, error) {
 	}
 
 	ghrepo.Client = ghclient
-	log.Trace(commits)
-	for _, c := range commits {
-		processCommit(c, ghrepo, cfg)
 
+	// for each commit in push, get files and check if files changed are
+	// ones that we are monitoring for changes
+	shas := pushedCommits(event, ghrepo)
+	log.Trace(shas)
+
+	// secrets deleted by a push to the default branch are no longer in the head of the repository
+	head := ref == "refs/heads/"+event.GetRepo().GetDefaultBranch()
+
+	var failed []string
+	for _, sha := range shas {
+		// a commit can be pushed several times, to several branches, only scan it once
+		scanned, err := db.IsCommitScanned(sha, fmt.Sprintf("%s/%s", owner, repo))
+		if err != nil {
+			log.Error(err)
+		}
+		if scanned {
+			log.WithFields(log.Fields{
+				"event":  "skipCommit",
+				"commit": sha,
+			}).Debug("Commit already scanned")
+			continue
+		}
+		if err := processCommit(sha, ghrepo, pusher, head, cfg); err != nil {
+			failed = append(failed, sha)
+		}
 	}
 	log.Debug("********* End Handling push event *********")
 
+	// scanned commits are recorded, so a retry only processes the failed ones
+	if len(failed) > 0 {
+		return http.StatusInternalServerError, []byte("Internal Server Error"), fmt.Errorf("could not scan commits %s", strings.Join(failed, ", "))
+	}
+
 	return 200, nil, nil
 
 }
 
-func processCommit(commit *github.HeadCommit, ghrepo gh.GithubRepo, c config.Config) {
+// pushedCommits returns the SHAs of all the commits introduced by a push, oldest first.
+// The webhook payload is limited to 20 commits, so the full list is retrieved from the compare API,
+// falling back on the payload if it fails.
+func pushedCommits(event github.PushEvent, ghrepo gh.GithubRepo) []string {
+	before := event.GetBefore()
+	after := event.GetAfter()
+	l := log.WithFields(log.Fields{
+		"event":  "pushedCommits",
+		"ref":    event.GetRef(),
+		"before": before,
+		"after":  after,
+	})
+
+	var shas []string
+	var err error
+
+	switch {
+	case event.GetDeleted() || isZeroSHA(after):
+		// the branch was deleted, nothing was pushed
+		l.Info("Branch deleted, nothing to scan")
+		return nil
+	case event.GetCreated() || isZeroSHA(before):
+		// there is no previous head to compare to, compare with the default branch instead
+		base := event.GetRepo().GetDefaultBranch()
+		if base == "" || event.GetRef() == "refs/heads/"+base {
+			// the webhook payload lists 20 commits at most, list all the commits of the branch instead
+			l.Info("Default branch created, scanning all its commits")
+			shas, err = gh.ListCommits(ghrepo, after)
+			break
+		}
+		l.WithFields(log.Fields{"base": base}).Info("Branch created, scanning commits not on the default branch")
+		shas, err = gh.CompareCommits(ghrepo, base, after)
+	case event.GetForced():
+		// before isn't an ancestor of after anymore, commits are compared from the merge base
+		l.Info("Force push, scanning commits since the merge base")
+		shas, err = gh.CompareCommits(ghrepo, before, after)
+	default:
+		shas, err = gh.CompareCommits(ghrepo, before, after)
+	}
+
+	if err == nil {
+		return shas
+	}
+	l.Error("Could not list the pushed commits ", err)
+	l.WithFields(log.Fields{"payloadCommits": len(event.Commits)}).Warn("Falling back on the commits of the webhook payload, which may be truncated")
+
+	shas = nil
+	for _, c := range event.Commits {
+		shas = append(shas, c.GetID())
+	}
+	return shas
+}
+
+// isZeroSHA returns true for the all-zero SHA GitHub uses when a ref doesn't exist
+func isZeroSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// processCommit scans the files of a commit pushed by pusher. When head is true, the commit is on the default branch,
+// and the open findings it deleted are marked as REMOVED_FROM_HEAD.
+func processCommit(sha string, ghrepo gh.GithubRepo, pusher string, head bool, c config.Config) error {
 
-	sha := *commit.ID
 	repo := ghrepo.Repo
 	owner := ghrepo.Owner
 	log.WithFields(log.Fields{
@@ -198,29 +316,174 @@ func processCommit(commit *github.HeadCommit, ghrepo gh.GithubRepo, c config.Con
 		"owner":  owner,
 		"commit": sha,
 	}).Info()
+
+	files, err := gh.GetCommitFiles(ghrepo, sha)
+	if err != nil {
+		log.Error("Could not list the files of the commit ", err)
+		return err
+	}
+
 	// create temp location for all the files to be downloaded to
 	// TODO: make this a configurable location with sane defaults
 	tmpFolder, err := ioutil.TempDir("", "lobster-pot")
 	if err != nil {
 		log.Error(err)
-		return
+		return err
 	}
+	// remove all files - make sure to capture the error if files couldn't be removed
+	defer func() {
+		if err := os.RemoveAll(tmpFolder); err != nil {
+			log.Error(err)
+		}
+	}()
 
 	// count of the total files in the commit. This is different from len(commit.Files) since
 	// a commit can contain deleted files, deleted files don't count as a scanned file
 	totalFiles := 0
 
-	for _, f := range commit.Removed {
-		log.WithFields(log.Fields{
-			"event":  "fileRemoved",
-			"commit": sha,
-			"file":   f,
-		}).Info()
+	var fileToScan []string
+	for _, f := range files {
+		if f.GetStatus() == "removed" {
+			log.WithFields(log.Fields{
+				"event":  "fileRemoved",
+				"commit": sha,
+				"file":   f.GetFilename(),
+			}).Info()
+			continue
+		}
+		fileToScan = append(fileToScan, f.GetFilename())
+	}
+
+	totalFiles = downloadFiles(tmpFolder, fileToScan, ghrepo, sha)
+
+	// in diff mode, findings on lines that the commit didn't add are reported as pre-existing
+	var added gh.AddedLines
+	if c.ScanMode == "diff" {
+		added = gh.NewAddedLines(files)
+	}
+
+	// scan all the downloaded files
+	results, dropped, err := scan(tmpFolder, ghrepo, sha, pusher, added, c)
+	if err != nil {
+		// the commit isn't saved as scanned, so it can be retried
+		return err
+	}
+	findingCount := 0
+	for _, r := range results {
+		if !r.Silenced {
+			findingCount++
+		}
+	}
+
+	// save commit info for metrics
+	// commit, repo, number of files scanned, findings
+	e := db.InsertCommitScan(sha, fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo), totalFiles, findingCount)
+	if e != nil {
+		log.Error(e)
+	}
+
+	// the previous failures of the commit, if any, have been retried successfully
+	e = db.ResolveScanErrors(fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo), sha)
+	if e != nil {
+		log.Error(e)
+	}
+
+	if head {
+		markRemovedFindings(tmpFolder, files, results, dropped, ghrepo, sha, c)
+	}
+
+	return nil
+}
+
+// markRemovedFindings marks as REMOVED_FROM_HEAD the open findings of the files deleted or renamed by the commit,
+// and the open findings of the changed files whose line was deleted by the commit, unless the scan found them
+// on another line. A finding the scan didn't report isn't removed otherwise: its secret may still be in the file,
+// missed after a change of the scanners or of their rules, or skipped as a duplicate.
+func markRemovedFindings(tmpFolder string, files []*github.CommitFile, results []scanResult, dropped []string, ghrepo gh.GithubRepo, sha string, c config.Config) {
+	found := make(map[string]bool)
+	for _, r := range results {
+		found[r.FID] = true
+	}
+	for _, fid := range dropped {
+		found[fid] = true
 	}
+	deleted := gh.NewDeletedLines(files)
+
+	repo := fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo)
+	for _, f := range files {
+		p := f.GetFilename()
+		// whole files are removed, the findings of the changed files only when their line is
+		wholeFile := true
+		switch f.GetStatus() {
+		case "removed":
+		case "renamed":
+			// the fid includes the path, the findings of the new path are new findings
+			p = f.GetPreviousFilename()
+		default:
+			// skipped files and files that couldn't be downloaded weren't scanned, their secrets may still be there
+			if _, err := os.Stat(filepath.Join(tmpFolder, p)); err != nil {
+				continue
+			}
+			wholeFile = false
+		}
 
-	fileToScan := append(commit.Added, commit.Modified...)
+		// the paths of the findings are relative to the scan folder, with a leading slash
+		fids, err := db.GetOpenFileFindings(repo, "/"+p)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for _, fid := range fids {
+			if found[fid] {
+				continue
+			}
+			if !wholeFile && !lineDeleted(fid, p, deleted) {
+				continue
+			}
+			l := log.WithFields(log.Fields{
+				"event":  "findingRemoved",
+				"commit": sha,
+				"file":   p,
+				"fid":    fid,
+			})
+			_, err := db.SetFindingStatus(fid, db.REMOVED_FROM_HEAD, db.ScanActor, fmt.Sprintf("removed by commit %s", sha))
+			if err != nil {
+				l.Error(err)
+				continue
+			}
+			l.Info("Finding removed from the default branch")
 
-	for _, f := range fileToScan {
+			decision := fmt.Sprintf(":wastebasket: Removed from the default branch by <https://github.com/%s/commit/%s|%s>", repo, sha, sha[:7])
+			updateFindingMessages(fid, triagedMessage(fid, db.REMOVED_FROM_HEAD, decision), ghrepo.App.SlackAppID, c)
+			refreshCheckRuns(fid, c)
+		}
+	}
+}
+
+// lineDeleted returns true if the commit deleted the line of the file on which the finding was last seen
+func lineDeleted(fid, path string, deleted gh.DeletedLines) bool {
+	occurrences, err := db.GetOccurrences(fid)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	if len(occurrences) == 0 {
+		return false
+	}
+	last := occurrences[len(occurrences)-1]
+	start, end, err := scanner.Finding{LineNumber: last.Line}.Lines()
+	if err != nil {
+		return false
+	}
+	return deleted.IsDeleted(path, start, end)
+}
+
+// downloadFiles downloads the files at the given commit into tmpFolder, skipping
+// vendored dependencies, and returns the number of files in the list
+func downloadFiles(tmpFolder string, files []string, ghrepo gh.GithubRepo, sha string) int {
+	totalFiles := 0
+
+	for _, f := range files {
 		totalFiles++
 
 		//TODO: make skipping configurable
@@ -270,26 +533,39 @@ func processCommit(commit *github.HeadCommit, ghrepo gh.GithubRepo, c config.Con
 		}
 
 	}
+	return totalFiles
+}
 
-	// scan all the downloaded files
-	findingCount, _ := scan(tmpFolder, ghrepo, sha, c)
+// scanResult is a finding reported by a scan, along with its id and triage status
+type scanResult struct {
+	FID          string
+	Path         string
+	Finding      scanner.Finding
+	Status       int
+	PreExisting  bool   // the finding is on lines that were not added by the scanned commit
+	Silenced     bool   // a pre-existing finding already known, neither counted nor reported again
+	Verification string // live, revoked or unknown, empty if the secret wasn't verified
+}
 
-	// save commit info for metrics
-	// commit, repo, number of files scanned, findings
-	e := db.InsertCommitScan(sha, fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo), totalFiles, findingCount)
-	if e != nil {
-		log.Error(e)
+// saveScanErrors records the failures of the scanners, so failed scans can be listed
+func saveScanErrors(err error, ghrepo gh.GithubRepo, sha string) {
+	var errs scanner.ScanErrors
+	if !errors.As(err, &errs) {
+		return
 	}
-
-	// remove all files - make sure to capture the error if files couldn't be removed
-	defer func() {
-		if err := os.RemoveAll(tmpFolder); err != nil {
-			log.Error(err)
+	for _, se := range errs {
+		e := db.InsertScanError(fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo), sha, se.Scanner, se.TimedOut, se.Err.Error(), se.Stderr)
+		if e != nil {
+			log.Error(e)
 		}
-	}()
+	}
 }
 
-func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (int, error) {
+// scan scans the files downloaded in tmpFolder and reports the findings to Slack.
+// If added is not nil, findings outside of the added lines are reported as pre-existing.
+// It also returns the fids of the findings found but not reported: dropped by the malformed policy,
+// or honeytokens already reported by the sweep.
+func scan(tmpFolder string, ghrepo gh.GithubRepo, sha, pusher string, added gh.AddedLines, c config.Config) ([]scanResult, []string, error) {
 	log.WithFields(log.Fields{
 		"event":  "scan",
 		"owner":  ghrepo.Owner,
@@ -301,9 +577,57 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 	findings, err := scanner.ScanFolder(tmpFolder, c)
 	if err != nil {
 		log.Error(err)
-		return 0, err
+		saveScanErrors(err, ghrepo, sha)
+		return nil, nil, err
 	}
 
+	// tag the tokens that don't match the format of their type. With the drop policy, they are
+	// dropped after the honeytokens check, since honeytokens are often fake tokens
+	findings = scanner.ValidateFindings(findings, scanner.MalformedMark)
+
+	// look for the real secrets registered by the security team
+	if c.KnownSecrets.Salt != "" {
+		known, err := db.GetKnownSecretHashes()
+		if err != nil {
+			log.Error(err)
+			return nil, nil, err
+		}
+		ks, err := scanner.FindKnownSecrets(tmpFolder, c.KnownSecrets.Salt, known)
+		if err != nil {
+			log.Error(err)
+			return nil, nil, err
+		}
+		findings = append(findings, ks...)
+	}
+
+	// look for the honeytokens in every file, a scanner may not recognize them as secrets
+	honeytokens, err := loadHoneytokens(c)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	hashes := make(map[string]bool, len(honeytokens))
+	for h := range honeytokens {
+		hashes[h] = true
+	}
+	htFindings, err := scanner.FindHoneytokens(tmpFolder, c.Honeytokens.Salt, hashes)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	// the honeytokens found by the sweep, by file, so the scanners' findings of the same honeytokens aren't alerted twice
+	swept := make(map[string]bool, len(htFindings))
+	for _, f := range htFindings {
+		h, _ := scanner.HoneytokenHash(f)
+		swept[f.FilePath+":"+h] = true
+	}
+	findings = append(findings, htFindings...)
+
+	results := make([]scanResult, 0, len(findings))
+	var dropped []string
+	// the new findings on lines the commit didn't add, listed in a single message
+	var preExisting []scanResult
+
 	// track findings that have been reported for a single commit
 	// incase multiple Grover rules trigger for a single file+comment
 	// we don't want to report the same file multiple times in a single commit
@@ -320,6 +644,93 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 			updated = 0
 		}
 
+		result := scanResult{FID: fid, Path: fPath, Finding: f, Status: status}
+
+		finding := db.Finding{
+			FID:         fid,
+			Repo:        fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo),
+			Path:        fPath,
+			RuleID:      f.RuleID,
+			Description: f.RuleDescription,
+			Severity:    strings.ToLower(f.Level),
+			Scanner:     f.Scanner,
+		}
+		if len(f.Scanners) > 0 {
+			finding.Scanner = strings.Join(f.Scanners, ",")
+		}
+		// every sighting of the finding is recorded, including the ones that aren't reported
+		recordOccurrence := func() {
+			e := db.InsertOccurrence(db.Occurrence{FID: fid, SHA: sha, Line: f.LineNumber, Pusher: pusher})
+			if e != nil {
+				log.Error(e)
+			}
+		}
+
+		if start, end, e := f.Lines(); e == nil {
+			result.PreExisting = added.IsPreExisting(fPath, start, end)
+		}
+
+		// a honeytoken leaving the place it was planted in is always reported, whatever the
+		// status of the finding and however recently it was reported
+		if ht, ok := matchHoneytoken(f, honeytokens, c); ok {
+			if _, sweep := scanner.HoneytokenHash(f); !sweep && swept[f.FilePath+":"+ht.Hash] {
+				// the secret is still in the file, reported by the sweep
+				dropped = append(dropped, fid)
+				continue
+			}
+			if status == -1 {
+				_, er := db.InsertFinding(finding)
+				if er != nil {
+					log.Error(er)
+				}
+				result.Status = db.NEW_FINDING
+			}
+			recordOccurrence()
+			log.WithFields(log.Fields{
+				"event":      "honeytoken",
+				"commit":     sha,
+				"filename":   fPath,
+				"honeytoken": ht.ID,
+			}).Warn()
+			QueueAlert(fid, honeytokenAlert(ht, ghrepo, sha, fPath, f), ghrepo.App.SlackAppID, c)
+			results = append(results, result)
+			continue
+		}
+
+		if f.Format == scanner.FormatMalformed && c.MalformedPolicy == scanner.MalformedDrop {
+			log.WithFields(log.Fields{
+				"event":    "scanMalformedFinding",
+				"commit":   sha,
+				"filename": fPath,
+			}).Info("Dropping malformed finding")
+			dropped = append(dropped, fid)
+			continue
+		}
+
+		// in diff mode, a secret that was already in the file isn't reported for triage again when
+		// the commit touches other lines. The ones never seen before are listed in a summary.
+		if result.PreExisting {
+			if status == -1 {
+				_, er := db.InsertFinding(finding)
+				if er != nil {
+					log.Error(er)
+				}
+				result.Status = db.NEW_FINDING
+				preExisting = append(preExisting, result)
+			} else {
+				log.WithFields(log.Fields{
+					"event":    "scanPreExistingFinding",
+					"commit":   sha,
+					"filename": fPath,
+					"status":   db.FindingValues[status],
+				}).Info("Not posting a known pre-existing finding")
+				result.Silenced = true
+			}
+			recordOccurrence()
+			results = append(results, result)
+			continue
+		}
+
 		// check if finding has come up before and if it has
 		// is it marked as a False-Positive or "Safe"
 		// this is based on the repository, filename and the comment
@@ -327,6 +738,22 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		// if finding is new -  warn
 		// if finding is FALSE_POSITIVE or KNOWN_SAFE - don't warn
 
+		// an exception that expired since the last run of the expiry job is lifted on sight,
+		// and the finding is reported again
+		lapsed := false
+		reintroduced := false
+		if status == db.FALSE_POSITIVE || status == db.KNOWN_SAFE {
+			reopened, e := db.ExpireFinding(fid)
+			if e != nil {
+				log.Error(e)
+			}
+			if reopened {
+				lapsed = true
+				status = db.NEW_FINDING
+				result.Status = status
+			}
+		}
+
 		if status == db.FALSE_POSITIVE || status == db.KNOWN_SAFE {
 			log.WithFields(log.Fields{
 				"event":    "scanKnownFinding",
@@ -334,6 +761,8 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 				"filename": fPath,
 				"status":   db.FindingValues[status],
 			}).Info()
+			recordOccurrence()
+			results = append(results, result)
 			continue
 		}
 
@@ -347,11 +776,21 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 			if status == db.NEW_FINDING {
 				status = db.REPEAT_FINDING
 			}
+			// a secret removed from the default branch that shows up again needs to be triaged again
+			if status == db.REMOVED_FROM_HEAD {
+				reintroduced = true
+				status = db.REPEAT_FINDING
+			}
+			result.Status = status
 			// update the last seen time
 			_, e := db.UpdateFinding(fid, status)
 			if e != nil {
 				log.Error(e)
 			}
+			// the check runs that were green with this finding triaged need it triaged again
+			if lapsed || reintroduced {
+				refreshCheckRuns(fid, c)
+			}
 
 			// check if seen in the last 15 min and skip report if reported in last 15 min
 			now := int(time.Now().Unix())
@@ -364,6 +803,8 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 					"status":   db.FindingValues[status],
 					"timeDiff": now - updated,
 				}).Info("Not posting because too recent")
+				recordOccurrence()
+				results = append(results, result)
 				continue
 			}
 		}
@@ -371,12 +812,25 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		// finding does not exist
 		if status == -1 {
 			// try insert the finding.
-			_, er := db.InsertFinding(sha, fmt.Sprintf("%s/%s", ghrepo.Owner, ghrepo.Repo), fPath, f.Secret)
+			_, er := db.InsertFinding(finding)
 
 			if er != nil {
 				log.Error(er)
 			}
+			result.Status = db.NEW_FINDING
 		}
+		recordOccurrence()
+
+		// check if the secret works, so live credentials stand out
+		verification, verifier := scanner.VerifyFinding(c.Verifiers, f)
+		if verification != "" {
+			result.Verification = verification
+			e := db.UpdateFindingVerification(fid, verification)
+			if e != nil {
+				log.Error(e)
+			}
+		}
+		results = append(results, result)
 
 		commitURL := fmt.Sprintf("https://github.com/%s/%s/commit/%s", ghrepo.Owner, ghrepo.Repo, sha)
 		// add the line number to the link to make finding the value easier
@@ -385,10 +839,17 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		// Build the message
 		// header
 		headerSection := createMarkdownBlock("Possible secret detected! :rotating_light:")
+		if f.Known {
+			headerSection = createMarkdownBlock("Known production secret detected! :rotating_light: :rotating_light: :rotating_light:")
+		}
 		divSection := slack.NewDividerBlock()
 
 		// file path
-		fileSection := createMarkdownBlock(fmt.Sprintf("*Repo:* %s/%s\n*Commit:* <%s|%s>\n*Description:* %s\n*FilePath:* <%s|%s#L%s>\n*Scanner:* %s", ghrepo.Owner, ghrepo.Repo, commitURL, sha, f.RuleDescription, fPathURL, fPath, f.LineNumber, f.Scanner))
+		fileText := fmt.Sprintf("*Repo:* %s/%s\n*Commit:* <%s|%s>\n*Description:* %s\n*FilePath:* <%s|%s#L%s>\n*Scanner:* %s", ghrepo.Owner, ghrepo.Repo, commitURL, sha, f.RuleDescription, fPathURL, fPath, f.LineNumber, strings.Join(f.Scanners, ", "))
+		if f.Level != "" {
+			fileText += fmt.Sprintf("\n*Level:* %s", f.Level)
+		}
+		fileSection := createMarkdownBlock(fileText)
 
 		// status section (optional)
 		// if it is a repeat finding make a note of it
@@ -400,6 +861,54 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		if status == db.REPEAT_FINDING {
 			statusSection = createMarkdownBlock(":warning: This is a REPEAT finding and has not been manually verified")
 		}
+		// the remediation of a verified secret is in progress
+		if status == db.ROTATION_PENDING {
+			statusSection = createMarkdownBlock(":warning: This secret has been verified, and its rotation is pending")
+		}
+		if status == db.ROTATED {
+			statusSection = createMarkdownBlock(":information_source: This secret has been rotated, it can be removed from the repository")
+		}
+		if reintroduced {
+			statusSection = createMarkdownBlock(":warning: This secret was removed from the default branch, and has been added again")
+		}
+		// if its exception expired, the finding needs to be triaged again
+		if lapsed {
+			statusSection = createMarkdownBlock(":hourglass: The exception granted for this finding has expired, it needs to be triaged again")
+		}
+
+		// agreement section (optional)
+		// several engines flagging the same secret is a strong signal of a true positive
+		var agreementSection *slack.SectionBlock
+		if len(f.Scanners) > 1 {
+			agreementSection = createMarkdownBlock(fmt.Sprintf(":dart: Flagged by %d scanners: %s", len(f.Scanners), strings.Join(f.Scanners, ", ")))
+		}
+
+		// verified section (optional)
+		// the secret was checked against its provider
+		var verifiedSection *slack.SectionBlock
+		switch verification {
+		case scanner.VerificationLive:
+			headerSection = createMarkdownBlock("Live secret detected! :rotating_light: :rotating_light:")
+			verifiedSection = createMarkdownBlock(fmt.Sprintf(":rotating_light: This secret is *live*, it was accepted by %s", verifier))
+		case scanner.VerificationRevoked:
+			verifiedSection = createMarkdownBlock(fmt.Sprintf(":white_check_mark: This secret was rejected by %s, it looks revoked", verifier))
+		case scanner.VerificationUnknown:
+			verifiedSection = createMarkdownBlock(fmt.Sprintf(":grey_question: This secret could not be verified with %s", verifier))
+		}
+
+		// format section (optional)
+		// the token doesn't match the layout or checksum of its type, it's likely a false positive
+		var formatSection *slack.SectionBlock
+		if f.Format == scanner.FormatMalformed {
+			formatSection = createMarkdownBlock(fmt.Sprintf(":small_blue_diamond: Low confidence: this doesn't look like a well-formed %s", f.TokenType))
+		}
+
+		// enrichment section (optional)
+		// what can be decoded from the secret, to save the triager from doing it by hand
+		var enrichmentSection *slack.SectionBlock
+		if e := scanner.Enrich(f); !e.IsEmpty() {
+			enrichmentSection = createMarkdownBlock(enrichmentText(e))
+		}
 
 		// test section (optional)
 		var testSection *slack.SectionBlock
@@ -419,11 +928,7 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 
 		// Action block with buttons
 
-		vButton := createStyledButton("Verified", "bVerified", fmt.Sprintf("verify_%s", fid), "danger")
-		fpButton := createStyledButton("False Positive", "bFP", fmt.Sprintf("fp_%s", fid), "primary")
-		ksButton := createStyledButton("Known Safe", "bSafe", fmt.Sprintf("safe_%s", fid), "primary")
-
-		actionBlock := slack.NewActionBlock("", vButton, fpButton, ksButton)
+		actionBlock := triageActionBlock(fid)
 
 		// Build the top part
 		msg := slack.NewBlockMessage(
@@ -436,6 +941,18 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		if statusSection != nil {
 			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, statusSection)
 		}
+		if verifiedSection != nil {
+			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, verifiedSection)
+		}
+		if agreementSection != nil {
+			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, agreementSection)
+		}
+		if enrichmentSection != nil {
+			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, enrichmentSection)
+		}
+		if formatSection != nil {
+			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, formatSection)
+		}
 		if testSection != nil {
 			msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, testSection)
 		}
@@ -453,12 +970,44 @@ func scan(tmpFolder string, ghrepo gh.GithubRepo, sha string, c config.Config) (
 		// reportedFindings = append(reportedFindings, f)
 
 	}
+
+	if len(preExisting) > 0 {
+		QueueMessage("", preExistingMessage(preExisting, ghrepo, sha), ghrepo.App.SlackAppID)
+	}
 	if len(findings) == 0 {
 		log.WithFields(log.Fields{"event": "scanResult", "commit": sha, "result": "Clean_scan"}).Info("Scan result")
 	} else {
 		log.WithFields(log.Fields{"event": "scanResult", "commit": sha, "result": "Found_secrets", "secrets_found": len(findings)}).Info("Scan result")
 	}
-	return len(findings), nil
+	return results, dropped, nil
+}
+
+// maxPreExistingListed is the number of findings listed in the pre-existing findings message
+const maxPreExistingListed = 10
+
+// preExistingMessage builds the message listing the new findings on lines a commit didn't add.
+// The secrets were already in the files, so the message is informational and has no triage buttons.
+func preExistingMessage(results []scanResult, ghrepo gh.GithubRepo, sha string) slack.Message {
+	commitURL := fmt.Sprintf("https://github.com/%s/%s/commit/%s", ghrepo.Owner, ghrepo.Repo, sha)
+	text := fmt.Sprintf("*Repo:* %s/%s\n*Commit:* <%s|%s>\nThis commit changed files already holding %d possible secrets, on lines it didn't add:",
+		ghrepo.Owner, ghrepo.Repo, commitURL, sha, len(results))
+	for i, r := range results {
+		if i == maxPreExistingListed {
+			text += fmt.Sprintf("\n... and %d more", len(results)-maxPreExistingListed)
+			break
+		}
+		fPathURL := fmt.Sprintf("https://github.com/%s/%s/blob/%s%s#L%s", ghrepo.Owner, ghrepo.Repo, sha, r.Path, r.Finding.LineNumber)
+		text += fmt.Sprintf("\n• <%s|%s#L%s> %s (`%s`)", fPathURL, r.Path, r.Finding.LineNumber, r.Finding.RuleDescription, r.FID)
+	}
+
+	msg := slack.NewBlockMessage(
+		createMarkdownBlock("Pre-existing secrets detected :mag:"),
+		slack.NewDividerBlock(),
+		createMarkdownBlock(text),
+		createMarkdownBlock(":information_source: They won't be reported again while they stay on untouched lines, and can be triaged with the API"),
+	)
+	msg.Text = "Pre-existing secrets detected"
+	return msg
 }
 
 type sampleKeys struct {
@@ -469,6 +1018,93 @@ type keyPair struct {
 	Value string `json:"value"`
 }
 
+// loadHoneytokens returns the registered honeytokens by hash, if the salt of the hashes is configured
+func loadHoneytokens(c config.Config) (map[string]db.Honeytoken, error) {
+	tokens, err := db.GetHoneytokens()
+	if err != nil {
+		return nil, err
+	}
+	if c.Honeytokens.Salt == "" {
+		if len(tokens) > 0 {
+			log.WithFields(log.Fields{"honeytokens": len(tokens)}).Error("Honeytokens are registered but HONEYTOKENS_SALT is not set, they can't be detected")
+		}
+		return nil, nil
+	}
+	honeytokens := make(map[string]db.Honeytoken, len(tokens))
+	for _, t := range tokens {
+		honeytokens[t.Hash] = t
+	}
+	return honeytokens, nil
+}
+
+// matchHoneytoken returns the honeytoken found in the secret of the finding, if any
+func matchHoneytoken(f scanner.Finding, honeytokens map[string]db.Honeytoken, c config.Config) (db.Honeytoken, bool) {
+	if len(honeytokens) == 0 {
+		return db.Honeytoken{}, false
+	}
+	if h, ok := scanner.HoneytokenHash(f); ok {
+		ht, ok := honeytokens[h]
+		return ht, ok
+	}
+	for _, h := range scanner.SecretHashes(c.Honeytokens.Salt, f) {
+		if ht, ok := honeytokens[h]; ok {
+			return ht, true
+		}
+	}
+	return db.Honeytoken{}, false
+}
+
+// honeytokenAlert builds the message posted to the alert channel when a honeytoken is found
+func honeytokenAlert(ht db.Honeytoken, ghrepo gh.GithubRepo, sha, fPath string, f scanner.Finding) slack.Message {
+	commitURL := fmt.Sprintf("https://github.com/%s/%s/commit/%s", ghrepo.Owner, ghrepo.Repo, sha)
+	fPathURL := fmt.Sprintf("https://github.com/%s/%s/blob/%s%s#L%s", ghrepo.Owner, ghrepo.Repo, sha, fPath, f.LineNumber)
+	// the findings of the honeytokens sweep aren't merged with the scanners' findings
+	scanners := strings.Join(f.Scanners, ", ")
+	if scanners == "" {
+		scanners = f.Scanner
+	}
+
+	headerSection := createMarkdownBlock(":rotating_light: :honey_pot: Honeytoken triggered! :honey_pot: :rotating_light:")
+	fileSection := createMarkdownBlock(fmt.Sprintf("*Repo:* %s/%s\n*Commit:* <%s|%s>\n*FilePath:* <%s|%s#L%s>\n*Scanner:* %s", ghrepo.Owner, ghrepo.Repo, commitURL, sha, fPathURL, fPath, f.LineNumber, scanners))
+	plantedSection := createMarkdownBlock(fmt.Sprintf("*Honeytoken:* %d\n*Planted in:* %s\n*Owner:* %s\n*Registered:* %s", ht.ID, ht.Location, ht.Owner, time.Unix(int64(ht.Created), 0).UTC().Format(time.RFC3339)))
+	contextSection := createMarkdownBlock(":warning: This credential was copied from where it was planted, and should never appear in a repository. The author of the commit had access to its location.")
+
+	return slack.NewBlockMessage(
+		headerSection,
+		slack.NewDividerBlock(),
+		fileSection,
+		plantedSection,
+		contextSection,
+	)
+}
+
+// enrichmentText formats the facts decoded from a secret for the Slack message
+func enrichmentText(e scanner.Enrichment) string {
+	var lines []string
+	if e.AWSAccountID != "" {
+		lines = append(lines, fmt.Sprintf(":cloud: AWS account: %s", e.AWSAccountID))
+	}
+	if e.JWT != nil {
+		lines = append(lines, fmt.Sprintf(":ticket: JWT issuer: %s, audience: %s, subject: %s", e.JWT.Issuer, strings.Join(e.JWT.Audience, ", "), e.JWT.Subject))
+		switch {
+		case e.JWT.ExpiresAt.IsZero():
+			lines = append(lines, ":warning: The JWT never expires")
+		case e.JWT.Expired:
+			lines = append(lines, fmt.Sprintf(":hourglass: The JWT expired on %s", e.JWT.ExpiresAt.Format(time.RFC3339)))
+		default:
+			lines = append(lines, fmt.Sprintf(":hourglass_flowing_sand: The JWT expires on %s", e.JWT.ExpiresAt.Format(time.RFC3339)))
+		}
+	}
+	if e.Key != nil {
+		if e.Key.Type == "encrypted" {
+			lines = append(lines, ":lock: Private key protected by a passphrase")
+		} else {
+			lines = append(lines, fmt.Sprintf(":key: %s private key, %d bits, fingerprint `%s`", e.Key.Type, e.Key.Size, e.Key.Fingerprint))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // checkExample compares the string with a list known safe keys
 // and checks if it contains the "EXAMPLE" keyword
 func checkExample(comment string) (bool, string) {
@@ -0,0 +1,73 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package handlers
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	gh "github.com/salesforce/lobster-pot/github"
+)
+
+func TestMarkRemovedFindings(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	t.Cleanup(func() { db.SetStore(nil) })
+
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	for _, f := range []struct {
+		fid, path, line string
+	}{
+		{fid: "fid-deleted-line", path: "/config.yml", line: "11"},
+		{fid: "fid-untouched-line", path: "/config.yml", line: "20"},
+		{fid: "fid-moved-line", path: "/config.yml", line: "12"},
+		{fid: "fid-removed-file", path: "/old.env", line: "1"},
+		{fid: "fid-renamed-file", path: "/deploy.sh", line: "3"},
+		{fid: "fid-not-downloaded", path: "/key.p12", line: "1"},
+	} {
+		if _, err := db.InsertFinding(db.Finding{FID: f.fid, Repo: "acme/api", Path: f.path, RuleID: "aws-key", Scanner: "golang"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertOccurrence(db.Occurrence{FID: f.fid, SHA: "previous", Line: f.line}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the changed files are downloaded, key.p12 was skipped
+	tmpFolder := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(tmpFolder, "config.yml"), []byte("password: hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := []*github.CommitFile{
+		{Filename: github.String("config.yml"), Status: github.String("modified"), Patch: github.String("@@ -10,4 +10,3 @@\n a\n-password: hunter2\n-aws: AKIA\n+aws: AKIA\n b")},
+		{Filename: github.String("old.env"), Status: github.String("removed")},
+		{Filename: github.String("scripts/deploy.sh"), PreviousFilename: github.String("deploy.sh"), Status: github.String("renamed")},
+		{Filename: github.String("key.p12"), Status: github.String("modified")},
+	}
+	// the secret of the moved line was found again by the scan
+	results := []scanResult{{FID: "fid-moved-line", Path: "/config.yml"}}
+
+	markRemovedFindings(tmpFolder, files, results, nil, gh.GithubRepo{Owner: "acme", Repo: "api"}, sha, config.Config{})
+
+	for fid, want := range map[string]int{
+		"fid-deleted-line":   db.REMOVED_FROM_HEAD,
+		"fid-untouched-line": db.NEW_FINDING,
+		"fid-moved-line":     db.NEW_FINDING,
+		"fid-removed-file":   db.REMOVED_FROM_HEAD,
+		"fid-renamed-file":   db.REMOVED_FROM_HEAD,
+		"fid-not-downloaded": db.NEW_FINDING,
+	} {
+		f, err := db.GetFinding(fid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Status != want {
+			t.Errorf("%s: status = %d, want %d", fid, f.Status, want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - pullrequest
+// Contains the logic to scan pull requests and report the results as GitHub check runs
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	gh "github.com/salesforce/lobster-pot/github"
+
+	"github.com/google/go-github/v39/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	checkSuccess = "success"
+	checkFailure = "failure"
+)
+
+func pullRequestEvent(event github.PullRequestEvent, cfg config.Config) error {
+	log.Debug("********* Start Handling pull request event *********")
+	//https://docs.github.com/en/developers/webhooks-and-events/webhooks/webhook-events-and-payloads#pull_request
+	number := event.GetNumber()
+	sha := event.GetPullRequest().GetHead().GetSHA()
+	repo := *event.Repo.Name
+	owner := *event.Repo.Owner.Login
+
+	l := log.WithFields(log.Fields{
+		"event":       "pullRequestEvent",
+		"action":      event.GetAction(),
+		"pullRequest": number,
+		"head":        sha,
+		"owner":       owner,
+		"repo":        repo,
+	})
+	l.Info()
+
+	app, ok := cfg.GithubApps[config.GithubOrgName(owner)]
+	if !ok {
+		l.Error("Could not find GitHub App for owner")
+		return fmt.Errorf("Could not find GitHub App for owner")
+	}
+
+	ghclient, err := gh.NewGithubAuthenticatedClient(app)
+	if err != nil {
+		l.Error("error getting Github authenticated client ", err)
+		return err
+	}
+
+	ghrepo := gh.GithubRepo{
+		Client: ghclient,
+		Repo:   repo,
+		Owner:  owner,
+		Ctx:    context.Background(),
+		App:    app,
+	}
+
+	checkRunID, err := gh.CreateCheckRun(ghrepo, sha)
+	if err != nil {
+		return err
+	}
+
+	conclusion, title, summary, annotations, fids := scanPullRequest(ghrepo, number, sha, event.GetSender().GetLogin(), cfg)
+
+	err = gh.CompleteCheckRun(ghrepo, checkRunID, conclusion, title, summary, annotations)
+	if err != nil {
+		return err
+	}
+
+	// keep track of the check run, so it can be updated when its findings are triaged
+	err = db.InsertCheckRun(checkRunID, fmt.Sprintf("%s/%s", owner, repo), sha, conclusion, fids)
+	if err != nil {
+		l.Error(err)
+	}
+
+	log.Debug("********* End Handling pull request event *********")
+	return nil
+}
+
+// scanPullRequest scans the files changed by the pull request at its head commit, pushed by pusher,
+// and returns the check run results along with the fids of the findings
+func scanPullRequest(ghrepo gh.GithubRepo, number int, sha, pusher string, c config.Config) (conclusion, title, summary string, annotations []*github.CheckRunAnnotation, fids []string) {
+
+	tmpFolder, err := ioutil.TempDir("", "lobster-pot")
+	if err != nil {
+		log.Error(err)
+		return checkFailure, "Scan failed", "The files of the pull request could not be scanned.", nil, nil
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpFolder); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	prFiles, err := gh.ListPullRequestFiles(ghrepo, number)
+	if err != nil {
+		return checkFailure, "Scan failed", "The files of the pull request could not be listed.", nil, nil
+	}
+
+	// removed files can't contain any new secret
+	var files []string
+	for _, f := range prFiles {
+		if f.GetStatus() == "removed" {
+			continue
+		}
+		files = append(files, f.GetFilename())
+	}
+	totalFiles := downloadFiles(tmpFolder, files, ghrepo, sha)
+
+	results, _, err := scan(tmpFolder, ghrepo, sha, pusher, nil, c)
+	if err != nil {
+		return checkFailure, "Scan failed", "The files of the pull request could not be scanned.", nil, nil
+	}
+
+	untriaged := 0
+	for _, r := range results {
+		fids = append(fids, r.FID)
+
+		level := "failure"
+		if isTriaged(r.Status) {
+			level = "notice"
+		} else {
+			untriaged++
+		}
+
+		start, end, e := r.Finding.Lines()
+		if e != nil {
+			log.Error(e)
+			start, end = 1, 1
+		}
+
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(strings.TrimPrefix(r.Path, "/")),
+			StartLine:       github.Int(start),
+			EndLine:         github.Int(end),
+			AnnotationLevel: github.String(level),
+			Title:           github.String("Possible secret detected"),
+			Message:         github.String(fmt.Sprintf("%s\nScanner: %s\nStatus: %s", r.Finding.RuleDescription, strings.Join(r.Finding.Scanners, ", "), db.FindingValues[r.Status])),
+		})
+	}
+
+	conclusion, title, summary = checkRunSummary(len(results), untriaged)
+	summary = fmt.Sprintf("%s\n\n%d file(s) scanned.", summary, totalFiles)
+	return conclusion, title, summary, annotations, fids
+}
+
+// checkRunSummary builds the conclusion and the texts of a check run from its finding counts
+func checkRunSummary(total, untriaged int) (conclusion, title, summary string) {
+	if total == 0 {
+		return checkSuccess, "No secrets detected", "No possible secrets were found in the files changed by this pull request."
+	}
+	if untriaged == 0 {
+		return checkSuccess, "All findings triaged", fmt.Sprintf("%d possible secret(s) found, all of them have been triaged.", total)
+	}
+	return checkFailure, "Possible secrets detected", fmt.Sprintf("%d possible secret(s) found, %d awaiting triage in Slack.", total, untriaged)
+}
+
+// isTriaged returns true if a decision has been taken on a finding with that status
+func isTriaged(status int) bool {
+	switch status {
+	case db.FALSE_POSITIVE, db.KNOWN_SAFE, db.VERIFIED_POSITIVE, db.ROTATION_PENDING, db.ROTATED, db.REMOVED_FROM_HEAD:
+		return true
+	}
+	return false
+}
+
+// refreshCheckRuns marks the check runs that reported the finding as successful once all
+// their findings have been triaged, and as failed again when one of them needs triage again,
+// after being reopened, or when its exception expired or its secret was added back
+func refreshCheckRuns(fid string, c config.Config) {
+	runs, err := db.GetCheckRunsFromFid(fid)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, cr := range runs {
+		l := log.WithFields(log.Fields{
+			"event":      "refreshCheckRun",
+			"checkRunID": cr.ID,
+			"repo":       cr.Repo,
+			"commit":     cr.SHA,
+		})
+
+		untriaged, err := db.CountUntriagedCheckRunFindings(cr.ID)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		conclusion, title := checkSuccess, "All findings triaged"
+		summary := "All possible secrets found in this pull request have been triaged."
+		if untriaged > 0 {
+			conclusion, title = checkFailure, "Possible secrets detected"
+			summary = fmt.Sprintf("%d possible secret(s) found in this pull request awaiting triage in Slack.", untriaged)
+		}
+		if conclusion == cr.Conclusion {
+			l.WithFields(log.Fields{"untriaged": untriaged}).Debug("Check run conclusion unchanged")
+			continue
+		}
+
+		ownerRepo := strings.SplitN(cr.Repo, "/", 2)
+		if len(ownerRepo) != 2 {
+			l.Error("Invalid repository name")
+			continue
+		}
+		app, ok := c.GithubApps[config.GithubOrgName(ownerRepo[0])]
+		if !ok {
+			l.Error("Could not find GitHub App for owner")
+			continue
+		}
+		ghclient, err := gh.NewGithubAuthenticatedClient(app)
+		if err != nil {
+			l.Error("error getting Github authenticated client ", err)
+			continue
+		}
+		ghrepo := gh.GithubRepo{
+			Client: ghclient,
+			Repo:   ownerRepo[1],
+			Owner:  ownerRepo[0],
+			Ctx:    context.Background(),
+			App:    app,
+		}
+
+		// the annotations were already published when the check run was created, only
+		// the conclusion and the summary change
+		err = gh.CompleteCheckRun(ghrepo, cr.ID, conclusion, title, summary, nil)
+		if err != nil {
+			continue
+		}
+		err = db.UpdateCheckRunConclusion(cr.ID, conclusion)
+		if err != nil {
+			l.Error(err)
+		}
+		l.WithFields(log.Fields{"conclusion": conclusion}).Info("Check run completed again")
+	}
+}
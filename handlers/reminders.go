@@ -0,0 +1,118 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - reminders
+// Contains the job reminding the channel of the findings waiting for triage past their SLA
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+var reminderInterval = 5 * time.Minute // how often the untriaged findings are checked against their SLA
+
+// StartReminderJob starts the job posting reminders in the thread of the findings waiting for triage,
+// and escalating them, according to the SLA policies. Several processes can run it.
+func StartReminderJob(c config.Config) {
+	if !c.SLA.Enabled() {
+		return
+	}
+	log.Debug("Starting reminder job")
+	go func() {
+		for {
+			remindFindings(c)
+			time.Sleep(reminderInterval)
+		}
+	}()
+}
+
+func remindFindings(c config.Config) {
+	findings, err := db.GetUntriagedFindings()
+	if err != nil {
+		log.Error("Could not read the untriaged findings ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, f := range findings {
+		// reminders are posted in the thread of the finding, nothing to do if it wasn't posted
+		if f.MessageTS == "" {
+			continue
+		}
+
+		p := c.SLA.Policy(f.Repo, f.Level)
+		age := now.Sub(time.Unix(int64(f.Since), 0))
+		lastReminder := time.Unix(int64(f.LastReminder), 0)
+
+		escalate := p.Escalation > 0 && age >= p.Escalation && f.Escalated == 0
+		remind := p.Reminder > 0 && age >= p.Reminder && now.Sub(lastReminder) >= p.Reminder
+		if !escalate && !remind {
+			continue
+		}
+
+		l := log.WithFields(log.Fields{"event": "remindFinding", "fid": f.FID, "repo": f.Repo, "escalate": escalate})
+
+		owner := strings.SplitN(f.Repo, "/", 2)[0]
+		app, ok := c.GithubApps[config.GithubOrgName(owner)]
+		if !ok {
+			l.Error("Could not find GitHub App for owner")
+			continue
+		}
+
+		recorded, err := db.RecordReminder(f, int(now.Unix()), escalate)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		if !recorded {
+			// another process just reminded it
+			continue
+		}
+
+		var text string
+		if escalate {
+			text = fmt.Sprintf(":rotating_light: %s this finding has been waiting for triage for %s, please triage it", slackMention(p.EscalateTo), formatAge(age))
+		} else {
+			text = fmt.Sprintf(":alarm_clock: This finding has been waiting for triage for %s", formatAge(age))
+		}
+		l.Info("Reminding finding")
+
+		msg := slack.NewBlockMessage(createMarkdownBlock(text))
+		msg.Text = text
+		msg.ThreadTimestamp = f.MessageTS
+		QueueMessage(f.FID, msg, app.SlackAppID)
+	}
+}
+
+// slackMention returns the mention of a Slack user group or user ID, such as S0123ABCD or U0123ABCD.
+// The other values accepted by the SLA policies, "here" and "channel", are special mentions.
+func slackMention(id string) string {
+	switch {
+	case strings.HasPrefix(id, "S"):
+		return fmt.Sprintf("<!subteam^%s>", id)
+	case strings.HasPrefix(id, "U"), strings.HasPrefix(id, "W"):
+		return fmt.Sprintf("<@%s>", id)
+	default:
+		return fmt.Sprintf("<!%s>", id)
+	}
+}
+
+// formatAge returns a duration in days, hours or minutes
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
@@ -7,8 +7,12 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
-	"strings"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/salesforce/lobster-pot/config"
@@ -17,113 +21,184 @@ import (
 	"github.com/slack-go/slack"
 )
 
-type Job struct {
-	FID     string
-	Msg     slack.Message
-	Retries int
-	appID   config.SlackAppID
+// QueueMessage adds a message to the slack outbox, stored in the database so that
+// pending messages survive a restart
+func QueueMessage(fid string, message slack.Message, slackAppID config.SlackAppID) {
+	m, err := json.Marshal(message)
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not encode slack message ", err)
+		return
+	}
+	err = db.InsertOutboxMessage(fid, string(slackAppID), "", string(m), db.OUTBOX_PRIORITY_NORMAL)
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not queue slack message ", err)
+	}
 }
 
-// QueueMessage adds a message to the slack message queue
-func QueueMessage(fid string, message slack.Message, slackAppID config.SlackAppID) {
-	// need to check if space in queue before inserting
-	// this will block until there is space in the queue
-	jb := &Job{fid, message, 0, slackAppID}
-	messageQueue <- jb
+// QueueAlert adds a message to the slack outbox, to be posted to the alert channel of the app
+// before the other messages waiting. Alerts can't be triaged, so they are not tracked once posted.
+func QueueAlert(fid string, message slack.Message, slackAppID config.SlackAppID, c config.Config) {
+	app, ok := c.SlackApps[slackAppID]
+	if !ok {
+		log.WithFields(log.Fields{"fid": fid}).Errorf("Slack app not found with id %s", slackAppID)
+		return
+	}
+	m, err := json.Marshal(message)
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not encode slack message ", err)
+		return
+	}
+	err = db.InsertOutboxMessage(fid, string(slackAppID), app.AlertChannel, string(m), db.OUTBOX_PRIORITY_ALERT)
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not queue slack alert ", err)
+	}
 }
 
-var messageQueue = make(chan *Job, 200) // space for queueing 200 slack messages
-var rateLimit = 200 * time.Millisecond  // basic rate limit to tick every 200 milliseconds
+var rateLimit = 200 * time.Millisecond   // basic rate limit between two messages posted by the same app
+var outboxPollInterval = 2 * time.Second // how often an idle worker checks the outbox
+var slackBaseBackoff = 10 * time.Second  // delay before the first retry, doubled for each attempt
+var slackMaxBackoff = 15 * time.Minute   // maximum delay between two retries
+var slackMaxAttempts = 5                 // number of attempts before a message is moved to the dead-letter state
 
-// StartQueueWorker starts the Slack Queue Worker to monitor a queue for new messages to post to slack
-// the worker ensures that messages are rate limited to avoid spamming the channel
+// StartQueueWorker starts a Slack Queue Worker for each Slack app, draining the outbox of new messages to post to slack.
+// The workers ensure that messages are rate limited per app to avoid spamming the channels
 func StartQueueWorker(c config.Config) {
 
-	log.Debug("Starting Slack Queue Worker")
-	//nolint:staticcheck // this is an endless loop
-	limiter := time.Tick(rateLimit)
-	go func() {
-		for {
-			<-limiter            // wait until the limiter ticks
-			jb := <-messageQueue // get message from the Queue
-			// try send message
-			log.WithFields(log.Fields{"Job Message": jb.Msg}).Debug("Posting to slack")
-			if messageTs, er := PostToSlack(jb.Msg, jb.appID, c); er != nil {
-				log.WithFields(
-					log.Fields{
-						"message id": messageTs,
-						"error":      er,
-					}).Debug("Error posting Slack message")
-				if rateLimitedError, ok := er.(*slack.RateLimitedError); ok {
-					// rate limited
-					// update the rate limiter
-					rl := rateLimitedError.RetryAfter
-					//nolint:staticcheck // this is an endless loop
-					limiter = time.Tick(time.Duration(rl) * time.Second)
-					// insert the message back into the queue
-					messageQueue <- jb
-					log.WithFields(log.Fields{"retry-after": rl}).Error("Rate limited")
-
-				} else { // some unhandled error, add message back to queue so we can try again
-					log.Error("Error posting to slack.", er)
-					if jb.Retries < 3 {
-						jb.Retries++
-						log.WithFields(log.Fields{"retries": jb.Retries}).Error("Adding message back to Queue")
-						// Update limiter with linear backoff
-						// TODO: update to a better backoff mechanism
-						//nolint:staticcheck // this is an endless loop
-						limiter = time.Tick(time.Duration(jb.Retries) * 10 * time.Second)
-						messageQueue <- jb
-					} else {
-						log.WithFields(log.Fields{"job fid": jb.FID}).Error("Message failed to send 3 times, dropping from queue")
-					}
-				}
-			} else {
-				// save message to database
-				// save MessageTS to the database, allowing for future updating
-				log.WithFields(log.Fields{"Job ID": jb.FID, "messageTs": messageTs}).Info("Inserting into DB")
-				err := db.InsertSlackMessage(jb.FID, messageTs)
-				if err != nil {
-					log.Error(err)
+	log.Debug("Starting Slack Queue Workers")
+	for appID := range c.SlackApps {
+		go slackQueueWorker(appID, c)
+	}
+}
+
+func slackQueueWorker(appID config.SlackAppID, c config.Config) {
+	for {
+		time.Sleep(rateLimit)
+
+		m, err := db.ClaimOutboxMessage(string(appID))
+		if err != nil {
+			log.WithFields(log.Fields{"appID": appID}).Error("Could not read the slack outbox ", err)
+			time.Sleep(outboxPollInterval)
+			continue
+		}
+		if m == nil {
+			time.Sleep(outboxPollInterval)
+			continue
+		}
+
+		l := log.WithFields(log.Fields{"appID": appID, "outbox id": m.ID, "fid": m.FID, "attempts": m.Attempts})
+
+		var msg slack.Message
+		if err := json.Unmarshal([]byte(m.Message), &msg); err != nil {
+			// the message will never be readable, no need to retry
+			l.Error("Could not decode slack message ", err)
+			if err := db.KillOutboxMessage(m.ID, err); err != nil {
+				l.Error(err)
+			}
+			continue
+		}
+
+		// try send message
+		l.WithFields(log.Fields{"Job Message": msg}).Debug("Posting to slack")
+		messageTs, er := PostToSlack(msg, appID, m.Channel, c)
+		if er == nil {
+			// save MessageTS to the database, allowing for future updating. Only the messages
+			// of the app's channel are updated, the alerts, the replies in threads and the summaries
+			// that aren't about a single finding are left as they are.
+			if m.Channel == "" && msg.ThreadTimestamp == "" && m.FID != "" {
+				l.WithFields(log.Fields{"messageTs": messageTs}).Info("Inserting into DB")
+				if err := db.InsertSlackMessage(m.FID, messageTs); err != nil {
+					l.Error(err)
 				}
-				// reset rate limiter
-				//nolint:staticcheck // this is an endless loop
-				limiter = time.Tick(rateLimit)
+			}
+			if err := db.MarkOutboxMessageSent(m.ID); err != nil {
+				l.Error(err)
+			}
+			continue
+		}
+
+		if rateLimitedError, ok := er.(*slack.RateLimitedError); ok {
+			// rate limited, put the message back and pause this app until slack allows it again
+			rl := rateLimitedError.RetryAfter
+			l.WithFields(log.Fields{"retry-after": rl}).Error("Rate limited")
+			if err := db.PostponeOutboxMessage(m.ID, time.Now().Add(rl)); err != nil {
+				l.Error(err)
+			}
+			time.Sleep(rl)
+			continue
+		}
 
+		if m.Attempts+1 >= slackMaxAttempts {
+			l.Error("Message failed to send too many times, moving it to the dead-letter state ", er)
+			if err := db.KillOutboxMessage(m.ID, er); err != nil {
+				l.Error(err)
 			}
+			continue
 		}
-	}()
+
+		retryAt := time.Now().Add(slackBackoff(m.Attempts + 1))
+		l.WithFields(log.Fields{"retryAt": retryAt}).Error("Error posting to slack, retrying later ", er)
+		if err := db.RetryOutboxMessage(m.ID, er, retryAt); err != nil {
+			l.Error(err)
+		}
+	}
+}
+
+// slackBackoff returns the delay before retrying a message that failed attempts times,
+// using an exponential backoff with jitter so retries of several messages don't happen at once
+func slackBackoff(attempts int) time.Duration {
+	d := slackBaseBackoff << uint(attempts-1)
+	if d > slackMaxBackoff || d <= 0 {
+		d = slackMaxBackoff
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return d/2 + time.Duration(jitter.Int63n(int64(d/2)+1))
 }
 
+// jitter is seeded per process, so that processes don't retry in lockstep
+var jitter = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterMu sync.Mutex
+
+// slackAPIURL is the URL of the Slack web API, replaced by the tests
+var slackAPIURL = slack.APIURL
+
 func slackAPI(app config.SlackApp) *slack.Client {
-	var options []slack.Option
+	options := []slack.Option{slack.OptionAPIURL(slackAPIURL)}
 	if log.IsLevelEnabled(log.TraceLevel) {
 		options = append(options, slack.OptionDebug(true))
 	}
 	return slack.New(app.Token, options...)
 }
 
-func PostToSlack(message slack.Message, appID config.SlackAppID, c config.Config) (messageTs string, err error) {
+// PostToSlack posts a message to channel, or to the app's channel if channel is empty.
+// Messages with a thread timestamp are posted as replies in the thread.
+func PostToSlack(message slack.Message, appID config.SlackAppID, channel string, c config.Config) (messageTs string, err error) {
 	log.WithFields(log.Fields{
 		"message": message,
 		"appID":   appID,
 	}).Debug("Posting to slack")
 	slackApp, ok := c.SlackApps[appID]
 	if !ok {
-		log.Error("Slack app not found with id %s", appID)
+		log.Errorf("Slack app not found with id %s", appID)
 		return "", fmt.Errorf("No slack app found for ID %s. Check your config", appID)
 	}
 
-	channel := slackApp.Channel
+	if channel == "" {
+		channel = slackApp.Channel
+	}
 	api := slackAPI(slackApp)
 
-	_, ts, err := api.PostMessage(
-		channel,
+	options := []slack.MsgOption{
 		slack.MsgOptionBlocks(message.Blocks.BlockSet...),
 		slack.MsgOptionText(message.Text, false),
 		slack.MsgOptionAttachments(message.Attachments...),
 		slack.MsgOptionAsUser(true), // Add this if you want that the bot would post message as a user, otherwise it will send response using the default slackbot
-	)
+	}
+	if message.ThreadTimestamp != "" {
+		options = append(options, slack.MsgOptionTS(message.ThreadTimestamp))
+	}
+
+	_, ts, err := api.PostMessage(channel, options...)
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Error("Error posting to slack")
@@ -148,14 +223,39 @@ func SlackCallback(w http.ResponseWriter, r *http.Request, c config.Config) {
 		return
 	}
 
-	//TODO: Validate Signature
+	// the raw body is needed to validate the signature
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSlackBodySize))
+	if err != nil {
+		log.Error("Could not read slack callback body: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		log.Error("Could not parse slack callback form: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	var payload slack.InteractionCallback
 
-	err := json.Unmarshal([]byte(r.FormValue("payload")), &payload)
+	err = json.Unmarshal([]byte(form.Get("payload")), &payload)
 
 	if err != nil {
 		log.Error("Could not parse action response JSON: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the payload can only be trusted once it is verified with the signing secret of the app it claims to come from
+	if err := verifySlackSignature(r.Header, body, config.SlackAppID(payload.APIAppID), c); err != nil {
+		log.WithFields(log.Fields{"appID": payload.APIAppID}).Error("Invalid slack signature: ", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, e := w.Write([]byte("Signature mismatch!"))
+		if e != nil {
+			log.Error(e)
+		}
 		return
 	}
 
@@ -166,39 +266,19 @@ func SlackCallback(w http.ResponseWriter, r *http.Request, c config.Config) {
 
 	appID := config.SlackAppID(payload.APIAppID)
 
-	actionID := payload.ActionCallback.BlockActions[0].ActionID
-	userID := payload.User.ID
-	originalMessage := payload.Message.Msg
-	messageTS := originalMessage.Timestamp
-	responseURL := payload.ResponseURL
-
-	var verifiedAs string
-	var er error
-
-	// actionID will be: verify_fid, fp_fid, safe_fid
-	// split to get the status to set and the fid of the finding to change
-	status := strings.Split(actionID, "_")
-
-	log.WithFields(log.Fields{
-		"actionID":    actionID,
-		"userID":      userID,
-		"messageTS":   messageTS,
-		"status":      status,
-		"responseURL": responseURL,
-	}).Debug("Slack callback details")
-
-	switch status[0] {
-	case "verify":
-		_, er = db.UpdateFinding(status[1], db.VERIFIED_POSITIVE)
-		verifiedAs = fmt.Sprintf(":fire: Verified by <@%s> as POSITIVE", userID)
-	case "fp":
-		_, er = db.UpdateFinding(status[1], db.FALSE_POSITIVE)
-		verifiedAs = fmt.Sprintf(":checkmark: Verified by <@%s> as FALSE_POSITIVE", userID)
-	case "safe":
-		_, er = db.UpdateFinding(status[1], db.KNOWN_SAFE)
-		verifiedAs = fmt.Sprintf(":checkmark: Verified by <@%s> as KNOWN_SAFE", userID)
+	switch payload.Type {
+	case slack.InteractionTypeBlockActions:
+		// the triage buttons open a modal asking for the reason of the decision,
+		// the finding is only updated once the modal is submitted
+		err = openTriageModal(payload, appID, c)
+		if err != nil {
+			log.WithFields(log.Fields{"userID": payload.User.ID}).Error("Could not open the triage modal ", err)
+		}
+	case slack.InteractionTypeViewSubmission:
+		triageSubmission(w, payload, appID, c)
+		return
 	default:
-		log.Error("Unknown action state")
+		log.WithFields(log.Fields{"type": payload.Type}).Error("Unsupported slack callback")
 	}
 
 	// respond to slack that the message has been parsed
@@ -209,54 +289,27 @@ func SlackCallback(w http.ResponseWriter, r *http.Request, c config.Config) {
 	if e != nil {
 		log.Error(e)
 	}
+}
 
-	// if an error had occurred during the update of the status, report error and
-	// don't update the slack message
-	if er != nil {
-		log.Error(er)
-		return
-	}
-
-	// rebuild the original message, we want all the same info except the actions section that contained the buttons
-	originalBlocks := originalMessage.Blocks.BlockSet
-	newBlocks := []slack.Block{}
-
-	// keep all blocks except the actions section
-	for _, block := range originalBlocks {
-		if block.BlockType() != slack.MBTAction {
-			log.WithFields(log.Fields{"block": block}).Debug("appending Block")
-			newBlocks = append(newBlocks, block)
-		}
-	}
+// maximum size of an interactivity payload read from Slack
+const maxSlackBodySize = 1 << 20
 
-	if log.IsLevelEnabled(log.TraceLevel) {
-		nb, _ := json.Marshal(newBlocks)
-		log.WithFields(log.Fields{"new blocks": string(nb)}).Trace("filtering new blocks")
+// verifySlackSignature checks the X-Slack-Signature header of a request against the signing secret of the Slack app.
+// Requests with a X-Slack-Request-Timestamp older than 5 minutes are rejected, to prevent replays.
+func verifySlackSignature(header http.Header, body []byte, appID config.SlackAppID, c config.Config) error {
+	slackApp, ok := c.SlackApps[appID]
+	if !ok {
+		return fmt.Errorf("No slack app found for ID %s. Check your config", appID)
 	}
 
-	verifiedAsBlock := createMarkdownBlock(verifiedAs)
-	newBlocks = append(newBlocks, verifiedAsBlock)
-
-	msg := slack.NewBlockMessage(newBlocks...)
-
-	if log.IsLevelEnabled(log.TraceLevel) {
-		m, _ := json.Marshal(msg)
-		log.WithFields(log.Fields{"message": string(m)}).Trace("Creating message with blocks")
-	}
-	msg.Text = verifiedAs
-	if log.IsLevelEnabled(log.DebugLevel) {
-		m, _ := json.Marshal(msg)
-		log.WithFields(log.Fields{"message": string(m)}).Debug("Adding text to message")
+	sv, err := slack.NewSecretsVerifier(header, slackApp.SigningSecret)
+	if err != nil {
+		return err
 	}
-
-	// update the message in slack
-	er = UpdateSlack(msg, messageTS, responseURL, appID, c)
-	if er != nil {
-		log.Error(e)
+	if _, err := sv.Write(body); err != nil {
+		return err
 	}
-	// update all other findings with the same fid as this one
-	UpdateSlackMessages(msg, messageTS, appID, c)
-
+	return sv.Ensure()
 }
 
 func UpdateSlack(message slack.Message, ts string, respURL string, appID config.SlackAppID, c config.Config) (err error) {
@@ -302,6 +355,11 @@ func UpdateSlackMessages(message slack.Message, messageTS string, appID config.S
 		log.Error(err)
 		return
 	}
+	updateFindingMessages(fid, message, appID, c)
+}
+
+// updateFindingMessages updates all the slack messages posted for a finding
+func updateFindingMessages(fid string, message slack.Message, appID config.SlackAppID, c config.Config) {
 	// get all the messages that have been sent for that fid
 	fids, err := db.GetSlackMessagesFromFid(fid)
 	if err != nil {
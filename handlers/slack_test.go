@@ -0,0 +1,140 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// testSlackConfig returns a config with the Slack app of the recorded payloads
+func testSlackConfig() config.Config {
+	return config.Config{
+		SlackApps: config.SlackApps{
+			"A02A8JQ6W5R": config.SlackApp{
+				Id:            "A02A8JQ6W5R",
+				Channel:       "C0123ABCDEF",
+				Token:         "xoxb-test",
+				SigningSecret: testSigningSecret,
+			},
+		},
+	}
+}
+
+// slackBody returns the form body Slack posts for an interaction payload
+func slackBody(payload string) []byte {
+	return []byte("payload=" + url.QueryEscape(payload))
+}
+
+// signSlackRequest sets the headers Slack signs its requests with
+func signSlackRequest(r *http.Request, body []byte, secret string, ts time.Time) {
+	timestamp := fmt.Sprintf("%d", ts.Unix())
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestSlackCallbackSignature(t *testing.T) {
+	recorded, err := ioutil.ReadFile("testdata/slack_block_actions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the triage modal is opened with the Slack API once the request is verified
+	var opened []string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			TriggerID string `json:"trigger_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		opened = append(opened, r.URL.Path+" "+req.TriggerID)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok": true}`)
+	}))
+	defer slack.Close()
+	defer func(u string) { slackAPIURL = u }(slackAPIURL)
+	slackAPIURL = slack.URL + "/"
+
+	unknownApp := strings.Replace(string(recorded), "A02A8JQ6W5R", "A0UNKNOWN00", 1)
+
+	tests := []struct {
+		name    string
+		payload string
+		secret  string
+		ts      time.Time
+		unsign  bool
+		status  int
+		opened  bool
+	}{
+		{name: "valid signature", payload: string(recorded), secret: testSigningSecret, ts: time.Now(), status: http.StatusOK, opened: true},
+		{name: "bad signature", payload: string(recorded), secret: "not the signing secret", ts: time.Now(), status: http.StatusUnauthorized},
+		{name: "stale timestamp", payload: string(recorded), secret: testSigningSecret, ts: time.Now().Add(-6 * time.Minute), status: http.StatusUnauthorized},
+		{name: "missing header", payload: string(recorded), unsign: true, status: http.StatusUnauthorized},
+		{name: "unknown app", payload: unknownApp, secret: testSigningSecret, ts: time.Now(), status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened = nil
+			body := slackBody(tt.payload)
+			r := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if !tt.unsign {
+				signSlackRequest(r, body, tt.secret, tt.ts)
+			}
+			w := httptest.NewRecorder()
+
+			SlackCallback(w, r, testSlackConfig())
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.opened != (len(opened) == 1) {
+				t.Errorf("slack API calls = %v, want a modal opened: %v", opened, tt.opened)
+			}
+			if tt.opened && opened[0] != "/views.open 3745104926497.8236473917.c6d2e0aa0e56d0f6cd6a1c22cd6f1e0e" {
+				t.Errorf("slack API call = %s", opened[0])
+			}
+		})
+	}
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	body := []byte("payload=%7B%7D")
+	c := testSlackConfig()
+
+	r := httptest.NewRequest(http.MethodPost, "/slack", nil)
+	signSlackRequest(r, body, testSigningSecret, time.Now())
+	if err := verifySlackSignature(r.Header, body, "A02A8JQ6W5R", c); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+
+	// the body can't be changed once signed
+	if err := verifySlackSignature(r.Header, []byte("payload=%7B%22a%22%7D"), "A02A8JQ6W5R", c); err == nil {
+		t.Error("signature of another body accepted")
+	}
+
+	// nor the signature be checked with the secret of another app
+	if err := verifySlackSignature(r.Header, body, "A0UNKNOWN00", c); err == nil {
+		t.Error("unknown app accepted")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - triage
+// Contains the Slack modal asking for the reason of a triage decision
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+// triageStatuses are the statuses a finding can be set to from Slack, by action
+var triageStatuses = map[string]int{
+	"verify":   db.VERIFIED_POSITIVE,
+	"fp":       db.FALSE_POSITIVE,
+	"safe":     db.KNOWN_SAFE,
+	"reopen":   db.NEW_FINDING,
+	"rotating": db.ROTATION_PENDING,
+	"rotated":  db.ROTATED,
+}
+
+// triageTitles are the titles of the modal, by action. "change" lets the user pick the status.
+var triageTitles = map[string]string{
+	"verify":   "Verified positive",
+	"fp":       "False positive",
+	"safe":     "Known safe",
+	"reopen":   "Reopen finding",
+	"change":   "Change status",
+	"rotating": "Rotation in progress",
+	"rotated":  "Secret rotated",
+}
+
+const triageCallbackID = "triage"
+
+// layout of the dates returned by the Slack date pickers
+const slackDateLayout = "2006-01-02"
+
+// triageMetadata is kept in the private metadata of the modal, to know which finding and message it is about
+type triageMetadata struct {
+	FID    string `json:"fid"`
+	Action string `json:"action"`
+	TS     string `json:"ts"`
+}
+
+// triageActionBlock returns the buttons used to triage a new finding
+func triageActionBlock(fid string) *slack.ActionBlock {
+	vButton := createStyledButton("Verified", "bVerified", fmt.Sprintf("verify_%s", fid), "danger")
+	fpButton := createStyledButton("False Positive", "bFP", fmt.Sprintf("fp_%s", fid), "primary")
+	ksButton := createStyledButton("Known Safe", "bSafe", fmt.Sprintf("safe_%s", fid), "primary")
+	return slack.NewActionBlock("", vButton, fpButton, ksButton)
+}
+
+// triagedActionBlock returns the buttons kept on a triaged finding, so the decision can be revised.
+// The rotation of the verified secrets can be confirmed, once started then once done.
+func triagedActionBlock(fid string, status int) *slack.ActionBlock {
+	var buttons []slack.BlockElement
+	if status == db.VERIFIED_POSITIVE {
+		buttons = append(buttons, createStyledButton("Rotation started", "bRotating", fmt.Sprintf("rotating_%s", fid), "primary"))
+	}
+	if status == db.VERIFIED_POSITIVE || status == db.ROTATION_PENDING {
+		buttons = append(buttons, createStyledButton("Rotated", "bRotated", fmt.Sprintf("rotated_%s", fid), "primary"))
+	}
+	buttons = append(buttons,
+		createStyledButton("Change status", "bChange", fmt.Sprintf("change_%s", fid), ""),
+		createStyledButton("Reopen", "bReopen", fmt.Sprintf("reopen_%s", fid), ""),
+	)
+	return slack.NewActionBlock("", buttons...)
+}
+
+// openTriageModal opens the modal asking for the reason of the decision, when a triage button is clicked
+func openTriageModal(payload slack.InteractionCallback, appID config.SlackAppID, c config.Config) error {
+	if len(payload.ActionCallback.BlockActions) == 0 {
+		return fmt.Errorf("no action in the slack callback")
+	}
+
+	// actionID will be: verify_fid, fp_fid, safe_fid, change_fid, reopen_fid, rotating_fid, rotated_fid
+	// split to get the action and the fid of the finding to change
+	actionID := payload.ActionCallback.BlockActions[0].ActionID
+	action := strings.SplitN(actionID, "_", 2)
+	if len(action) != 2 || triageTitles[action[0]] == "" {
+		return fmt.Errorf("unknown action: %s", actionID)
+	}
+
+	slackApp, ok := c.SlackApps[appID]
+	if !ok {
+		return fmt.Errorf("No slack app found for ID %s. Check your config", appID)
+	}
+
+	modal, err := triageModal(triageMetadata{FID: action[1], Action: action[0], TS: payload.Message.Timestamp})
+	if err != nil {
+		return err
+	}
+	_, err = slackAPI(slackApp).OpenView(payload.TriggerID, modal)
+	return err
+}
+
+// triageModal builds the modal of an action: a mandatory reason, the status to set for "change",
+// and an optional expiry when the finding can be marked as a false positive or known safe
+func triageModal(meta triageMetadata) (slack.ModalViewRequest, error) {
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return slack.ModalViewRequest{}, err
+	}
+
+	plainText := func(text string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject("plain_text", text, false, false)
+	}
+
+	blocks := []slack.Block{}
+	if meta.Action == "change" {
+		status := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plainText("Select a status"), "status",
+			slack.NewOptionBlockObject("verify", plainText("Verified positive"), nil),
+			slack.NewOptionBlockObject("fp", plainText("False positive"), nil),
+			slack.NewOptionBlockObject("safe", plainText("Known safe"), nil),
+			slack.NewOptionBlockObject("rotating", plainText("Rotation pending"), nil),
+			slack.NewOptionBlockObject("rotated", plainText("Rotated"), nil),
+		)
+		blocks = append(blocks, slack.NewInputBlock("status", plainText("Status"), status))
+	}
+
+	placeholder := "Why is this the right status?"
+	if meta.Action == "rotating" || meta.Action == "rotated" {
+		placeholder = "Which credential was issued, where is it deployed?"
+	}
+	reason := slack.NewPlainTextInputBlockElement(plainText(placeholder), "reason")
+	reason.Multiline = true
+	blocks = append(blocks, slack.NewInputBlock("reason", plainText("Reason"), reason))
+
+	if meta.Action == "fp" || meta.Action == "safe" || meta.Action == "change" {
+		expiry := slack.NewInputBlock("expiry", plainText("Expires on"), slack.NewDatePickerBlockElement("expiry"))
+		expiry.Optional = true
+		expiry.Hint = plainText("False positive and known safe only. The finding is reopened on that date, leave empty if the decision doesn't expire.")
+		blocks = append(blocks, expiry)
+	}
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           plainText(triageTitles[meta.Action]),
+		Close:           plainText("Cancel"),
+		Submit:          plainText("Save"),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: string(m),
+		CallbackID:      triageCallbackID,
+	}, nil
+}
+
+// triageSubmission saves the decision submitted with the triage modal, and updates the slack messages of the finding.
+// Invalid submissions are answered with the errors to display in the modal.
+func triageSubmission(w http.ResponseWriter, payload slack.InteractionCallback, appID config.SlackAppID, c config.Config) {
+	var meta triageMetadata
+	if payload.View.CallbackID != triageCallbackID || payload.View.State == nil {
+		log.WithFields(log.Fields{"callbackID": payload.View.CallbackID}).Error("Unknown view submission")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal([]byte(payload.View.PrivateMetadata), &meta); err != nil {
+		log.Error("Could not parse the view metadata: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	values := payload.View.State.Values
+
+	action := meta.Action
+	if action == "change" {
+		action = values["status"]["status"].SelectedOption.Value
+	}
+	status, ok := triageStatuses[action]
+	if !ok {
+		writeViewErrors(w, map[string]string{"status": "Select a status"})
+		return
+	}
+
+	reason := strings.TrimSpace(values["reason"]["reason"].Value)
+	if reason == "" {
+		writeViewErrors(w, map[string]string{"reason": "A reason is required"})
+		return
+	}
+
+	// the expiry only applies to the exceptions, the findings are never reported again otherwise
+	var expires time.Time
+	if d := values["expiry"]["expiry"].SelectedDate; d != "" && (status == db.FALSE_POSITIVE || status == db.KNOWN_SAFE) {
+		var err error
+		expires, err = time.Parse(slackDateLayout, d)
+		if err != nil || !expires.After(time.Now()) {
+			writeViewErrors(w, map[string]string{"expiry": "The expiry date must be in the future"})
+			return
+		}
+	}
+
+	userID := payload.User.ID
+	actor := db.Actor{ID: userID, Name: payload.User.Name, Source: db.SOURCE_SLACK}
+
+	l := log.WithFields(log.Fields{"fid": meta.FID, "action": action, "userID": userID, "messageTS": meta.TS})
+	l.Debug("Triage submitted")
+
+	var e int
+	if !expires.IsZero() {
+		e = int(expires.Unix())
+	}
+	_, err := db.TriageFinding(meta.FID, status, e, actor, reason)
+	if err != nil {
+		l.Error(err)
+		writeViewErrors(w, map[string]string{"reason": "The decision could not be saved, please retry"})
+		return
+	}
+
+	// an empty response closes the modal. Slack drops the submission if it isn't answered
+	// within 3 seconds, so the messages and the check runs are updated once it is.
+	w.WriteHeader(http.StatusOK)
+	go updateTriagedFinding(meta, status, triageDecision(fmt.Sprintf("<@%s>", userID), status, reason, expires), appID, c)
+}
+
+// updateTriagedFinding updates the slack messages and the check runs of a finding triaged from a modal
+func updateTriagedFinding(meta triageMetadata, status int, decision string, appID config.SlackAppID, c config.Config) {
+	l := log.WithFields(log.Fields{"fid": meta.FID, "messageTS": meta.TS})
+	msg := triagedMessage(meta.FID, status, decision)
+
+	// update the message in slack, and all other messages with the same fid as this one
+	if meta.TS != "" {
+		err := UpdateSlack(msg, meta.TS, "", appID, c)
+		if err != nil {
+			l.Error(err)
+		}
+		UpdateSlackMessages(msg, meta.TS, appID, c)
+	}
+
+	// pull requests waiting on this finding can be unblocked once everything is triaged
+	refreshCheckRuns(meta.FID, c)
+}
+
+// triageDecision returns the text telling who triaged the finding, and why.
+// who is the Slack mention of the user, or the name of the API token.
+func triageDecision(who string, status int, reason string, expires time.Time) string {
+	var decision string
+	switch status {
+	case db.VERIFIED_POSITIVE:
+		decision = fmt.Sprintf(":fire: Verified by %s as POSITIVE", who)
+	case db.FALSE_POSITIVE:
+		decision = fmt.Sprintf(":checkmark: Verified by %s as FALSE_POSITIVE", who)
+	case db.KNOWN_SAFE:
+		decision = fmt.Sprintf(":checkmark: Verified by %s as KNOWN_SAFE", who)
+	case db.ROTATION_PENDING:
+		decision = fmt.Sprintf(":hourglass_flowing_sand: Rotation started by %s", who)
+	case db.ROTATED:
+		decision = fmt.Sprintf(":white_check_mark: Rotation confirmed by %s", who)
+	default:
+		decision = fmt.Sprintf(":leftwards_arrow_with_hook: Reopened by %s", who)
+	}
+	if !expires.IsZero() {
+		decision += fmt.Sprintf(" until %s", expires.Format(slackDateLayout))
+	}
+
+	// the reason is quoted, and escaped so it can't mention users or channels
+	reason = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(reason)
+	return decision + "\n>" + strings.ReplaceAll(reason, "\n", "\n>")
+}
+
+// triagedMessage rebuilds the message posted for the finding, with the decision instead of the triage buttons.
+// Reopened findings get the triage buttons back, the others can be changed or reopened.
+func triagedMessage(fid string, status int, decision string) slack.Message {
+	var original slack.Message
+	m, err := db.GetSentOutboxMessage(fid)
+	if err != nil {
+		log.WithFields(log.Fields{"fid": fid}).Error("Could not read the original slack message ", err)
+	}
+	if m != "" {
+		if err := json.Unmarshal([]byte(m), &original); err != nil {
+			log.WithFields(log.Fields{"fid": fid}).Error("Could not decode the original slack message ", err)
+		}
+	}
+
+	// keep all blocks except the actions section
+	blocks := []slack.Block{}
+	for _, block := range original.Blocks.BlockSet {
+		if block.BlockType() != slack.MBTAction {
+			blocks = append(blocks, block)
+		}
+	}
+	blocks = append(blocks, createMarkdownBlock(decision))
+
+	if status == db.NEW_FINDING {
+		blocks = append(blocks, triageActionBlock(fid))
+	} else {
+		blocks = append(blocks, triagedActionBlock(fid, status))
+	}
+
+	msg := slack.NewBlockMessage(blocks...)
+	msg.Text = strings.SplitN(decision, "\n", 2)[0]
+
+	if log.IsLevelEnabled(log.TraceLevel) {
+		j, _ := json.Marshal(msg)
+		log.WithFields(log.Fields{"message": string(j)}).Trace("Triaged message")
+	}
+	return msg
+}
+
+// writeViewErrors answers a view submission with errors to display in the modal, by block ID
+func writeViewErrors(w http.ResponseWriter, errs map[string]string) {
+	resp, err := json.Marshal(slack.NewErrorsViewSubmissionResponse(errs))
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+// Package handlers - worker
+// Contains the worker pool processing the webhooks persisted in the jobs queue
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"time"
+
+	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
+
+	"github.com/google/go-github/v39/github"
+	log "github.com/sirupsen/logrus"
+)
+
+var jobPollInterval = 5 * time.Second // how often an idle worker checks for new jobs
+var jobBaseBackoff = 30 * time.Second // delay before the first retry, doubled for each attempt
+var jobMaxBackoff = time.Hour
+
+// StartJobWorkers starts the configured number of workers, processing the webhooks
+// saved in the jobs queue
+func StartJobWorkers(c config.Config) {
+	log.WithFields(log.Fields{"workers": c.Workers.Concurrency}).Debug("Starting job workers")
+	for i := 0; i < c.Workers.Concurrency; i++ {
+		go jobWorker(i, c)
+	}
+}
+
+func jobWorker(id int, c config.Config) {
+	for {
+		job, err := db.ClaimJob()
+		if err != nil {
+			log.WithFields(log.Fields{"worker": id}).Error("Could not claim job ", err)
+			time.Sleep(jobPollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(jobPollInterval)
+			continue
+		}
+
+		l := log.WithFields(log.Fields{
+			"worker":   id,
+			"job":      job.ID,
+			"delivery": job.Delivery,
+			"event":    job.Event,
+			"attempt":  job.Attempts,
+		})
+		l.Info("Processing job")
+
+		stop := renewJobLease(job.ID, l)
+		err = runJob(job, c)
+		close(stop)
+		switch {
+		case err == nil:
+			err = db.CompleteJob(job.ID)
+		case job.Attempts >= c.Workers.MaxAttempts:
+			l.Error("Job failed too many times, moving it to the dead-letter state ", err)
+			err = db.KillJob(job.ID, err)
+		default:
+			retryAt := time.Now().Add(jobBackoff(job.Attempts))
+			l.WithFields(log.Fields{"retryAt": retryAt}).Error("Job failed, retrying later ", err)
+			err = db.RetryJob(job.ID, err, retryAt)
+		}
+		if err != nil {
+			l.Error("Could not update job ", err)
+		}
+	}
+}
+
+// renewJobLease renews the lease of a job every db.JobHeartbeat, until the returned channel is closed
+func renewJobLease(id int, l *log.Entry) chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(db.JobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := db.RenewJob(id); err != nil {
+					l.Error("Could not renew the job lease ", err)
+				}
+			}
+		}
+	}()
+	return stop
+}
+
+// runJob processes a job, recovering from any panic so a single payload can't bring the worker down
+func runJob(job *db.Job, c config.Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{"job": job.ID, "stack": string(debug.Stack())}).Error("Panic while processing job")
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	event, err := github.ParseWebHook(job.Event, job.Payload)
+	if err != nil {
+		return err
+	}
+
+	switch e := event.(type) {
+	case *github.PushEvent:
+		_, _, err = pushEvent(*e, c)
+	case *github.PullRequestEvent:
+		err = pullRequestEvent(*e, c)
+	default:
+		err = fmt.Errorf("unsupported event: %s", job.Event)
+	}
+	return err
+}
+
+// jobBackoff returns the delay before retrying a job that failed attempts times
+func jobBackoff(attempts int) time.Duration {
+	d := time.Duration(float64(jobBaseBackoff) * math.Pow(2, float64(attempts-1)))
+	if d > jobMaxBackoff || d <= 0 {
+		return jobMaxBackoff
+	}
+	return d
+}
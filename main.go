@@ -5,11 +5,19 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/salesforce/lobster-pot/config"
+	"github.com/salesforce/lobster-pot/db"
 	"github.com/salesforce/lobster-pot/handlers"
+	"github.com/salesforce/lobster-pot/scanner"
 
 	_ "github.com/joho/godotenv/autoload"
 	log "github.com/sirupsen/logrus"
@@ -24,9 +32,74 @@ func main() {
 		log.Fatal(err)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5000"
+	// "lobster-pot migrate" applies the pending database migrations, when DB_MIGRATE_ON_START is false
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		version, err := db.Migrate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("database schema at version %d\n", version)
+		return
+	}
+
+	// the other commands need the schema to be up to date
+	err = db.CheckSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// "lobster-pot outbox" lets an admin inspect and replay the dead slack messages
+	if len(os.Args) > 1 && os.Args[1] == "outbox" {
+		err = outboxCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "lobster-pot scanerrors" lists the failed scans that haven't been retried successfully yet
+	if len(os.Args) > 1 && os.Args[1] == "scanerrors" {
+		err = scanErrorsCommand()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "lobster-pot history <fid>" prints the status changes and the sightings of a finding, for audit purposes
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		err = historyCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "lobster-pot honeytokens" manages the registry of the planted canary credentials
+	if len(os.Args) > 1 && os.Args[1] == "honeytokens" {
+		err = honeytokensCommand(os.Args[2:], os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "lobster-pot knownsecrets" manages the registry of the real secrets to look for
+	if len(os.Args) > 1 && os.Args[1] == "knownsecrets" {
+		err = knownSecretsCommand(os.Args[2:], os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "lobster-pot apitokens" manages the tokens of the REST API
+	if len(os.Args) > 1 && os.Args[1] == "apitokens" {
+		err = apiTokensCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	c, err := config.BuildAppsConfig()
@@ -37,6 +110,31 @@ func main() {
 	// setup the worker for posting to slack
 	handlers.StartQueueWorker(c)
 
+	// reopen the findings whose exception expired
+	handlers.StartExpiryJob(c)
+
+	// remind the channel of the findings waiting for triage past their SLA
+	handlers.StartReminderJob(c)
+
+	// "lobster-pot worker" only processes the queued webhooks, without serving http.
+	// By default, the web process also runs JOB_WORKERS workers.
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		if c.Workers.Concurrency == 0 {
+			log.Fatal("JOB_WORKERS must be greater than 0 for the worker process")
+		}
+		handlers.StartJobWorkers(c)
+		log.Debug("Worker started")
+		select {}
+	}
+
+	// setup the workers processing the received webhooks
+	handlers.StartJobWorkers(c)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "5000"
+	}
+
 	http.Handle("/",
 		handlers.AuthCheck(
 			http.HandlerFunc(
@@ -56,6 +154,9 @@ func main() {
 	http.Handle("/slack", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) { handlers.SlackCallback(w, r, c) },
 	))
+
+	// REST API, authenticated with the tokens created with "lobster-pot apitokens"
+	http.Handle("/api/v1/", handlers.APIHandler(c))
 	log.Debug("Starting server on port: ", port)
 	err = http.ListenAndServe(":"+port, nil)
 	if err != nil {
@@ -63,3 +164,273 @@ func main() {
 	}
 
 }
+
+// outboxCommand lists the slack messages in the dead-letter state ("outbox list"),
+// or puts one back in the outbox to be sent again ("outbox replay <id>")
+func outboxCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lobster-pot outbox list|replay <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		msgs, err := db.GetDeadOutboxMessages()
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			fmt.Printf("%d\tfid=%s\tapp=%s\tattempts=%d\tcreated=%s\terror=%s\n",
+				m.ID, m.FID, m.AppID, m.Attempts, time.Unix(int64(m.Created), 0).UTC().Format(time.RFC3339), m.LastError)
+		}
+	case "replay":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: lobster-pot outbox replay <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid message id: %s", args[1])
+		}
+		err = db.ReplayOutboxMessage(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Message %d queued\n", id)
+	default:
+		return fmt.Errorf("unknown outbox command: %s", args[0])
+	}
+	return nil
+}
+
+// scanErrorsCommand lists the unresolved scan failures. The failed commits are retried
+// by the job queue, and their failures are resolved once they are scanned.
+func scanErrorsCommand() error {
+	errs, err := db.GetScanErrors()
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		fmt.Printf("%d\trepo=%s\tsha=%s\tscanner=%s\ttimedout=%t\tcreated=%s\terror=%s\n",
+			e.ID, e.Repo, e.SHA, e.Scanner, e.TimedOut, time.Unix(int64(e.Created), 0).UTC().Format(time.RFC3339), e.Error)
+		if e.Stderr != "" {
+			fmt.Printf("\tstderr: %s\n", strings.ReplaceAll(strings.TrimSpace(e.Stderr), "\n", "\n\t        "))
+		}
+	}
+	return nil
+}
+
+// knownSecretsCommand lists the registered secrets ("knownsecrets list"), registers the secret read
+// from stdin ("knownsecrets add <name> <owner>"), or removes one ("knownsecrets remove <id>").
+// The secret is read from stdin so it doesn't end up in the shell history.
+func knownSecretsCommand(args []string, stdin io.Reader) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lobster-pot knownsecrets list|add <name> <owner>|remove <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		secrets, err := db.GetKnownSecrets()
+		if err != nil {
+			return err
+		}
+		for _, s := range secrets {
+			fmt.Printf("%d\tname=%s\towner=%s\tcreated=%s\n",
+				s.ID, s.Name, s.Owner, time.Unix(int64(s.Created), 0).UTC().Format(time.RFC3339))
+		}
+	case "add":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: echo -n <secret> | lobster-pot knownsecrets add <name> <owner>")
+		}
+		ks, err := config.BuildKnownSecretsConfig()
+		if err != nil {
+			return err
+		}
+		if ks.Salt == "" {
+			return fmt.Errorf("KNOWN_SECRETS_SALT is not set")
+		}
+		hash, err := readSecretHash(stdin, ks.Salt)
+		if err != nil {
+			return err
+		}
+		id, err := db.InsertKnownSecret(hash, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Known secret %d registered\n", id)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: lobster-pot knownsecrets remove <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid known secret id: %s", args[1])
+		}
+		err = db.DeleteKnownSecret(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Known secret %d removed\n", id)
+	default:
+		return fmt.Errorf("unknown knownsecrets command: %s", args[0])
+	}
+	return nil
+}
+
+// honeytokensCommand lists the registered honeytokens ("honeytokens list"), registers the honeytoken
+// read from stdin ("honeytokens add <location> <owner>"), or removes one ("honeytokens remove <id>")
+func honeytokensCommand(args []string, stdin io.Reader) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lobster-pot honeytokens list|add <location> <owner>|remove <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		tokens, err := db.GetHoneytokens()
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			fmt.Printf("%d\tlocation=%s\towner=%s\tcreated=%s\n",
+				t.ID, t.Location, t.Owner, time.Unix(int64(t.Created), 0).UTC().Format(time.RFC3339))
+		}
+	case "add":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: echo -n <honeytoken> | lobster-pot honeytokens add <location> <owner>")
+		}
+		ht, err := config.BuildHoneytokensConfig()
+		if err != nil {
+			return err
+		}
+		if ht.Salt == "" {
+			return fmt.Errorf("HONEYTOKENS_SALT is not set")
+		}
+		hash, err := readSecretHash(stdin, ht.Salt)
+		if err != nil {
+			return err
+		}
+		id, err := db.InsertHoneytoken(hash, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Honeytoken %d registered\n", id)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: lobster-pot honeytokens remove <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid honeytoken id: %s", args[1])
+		}
+		err = db.DeleteHoneytoken(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Honeytoken %d removed\n", id)
+	default:
+		return fmt.Errorf("unknown honeytokens command: %s", args[0])
+	}
+	return nil
+}
+
+// apiTokensCommand lists the API tokens ("apitokens list"), creates one ("apitokens create <name> <scope>..."),
+// or revokes one ("apitokens revoke <id>"). The token is only printed at its creation, only its hash is stored.
+func apiTokensCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lobster-pot apitokens list|create <name> <scope>...|revoke <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		tokens, err := db.GetAPITokens()
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			fmt.Printf("%d\tname=%s\tscopes=%s\trevoked=%t\tcreated=%s\n",
+				t.ID, t.Name, strings.Join(t.Scopes, ","), t.Revoked, time.Unix(int64(t.Created), 0).UTC().Format(time.RFC3339))
+		}
+	case "create":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: lobster-pot apitokens create <name> <scope>..., the scopes are: %s",
+				strings.Join(handlers.APIScopes, ", "))
+		}
+		err := handlers.ValidateAPIToken(args[1], args[2:])
+		if err != nil {
+			return err
+		}
+		token, hash, err := handlers.NewAPIToken()
+		if err != nil {
+			return err
+		}
+		id, err := db.InsertAPIToken(args[1], hash, args[2:])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API token %d created, it won't be shown again:\n%s\n", id, token)
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: lobster-pot apitokens revoke <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid API token id: %s", args[1])
+		}
+		err = db.RevokeAPIToken(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API token %d revoked\n", id)
+	default:
+		return fmt.Errorf("unknown apitokens command: %s", args[0])
+	}
+	return nil
+}
+
+// readSecretHash reads a secret on the first line of stdin, and returns its salted hash
+func readSecretHash(stdin io.Reader, salt string) (string, error) {
+	secret, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	secret = strings.TrimRight(secret, "\r\n")
+	if err := scanner.ValidateKnownSecret(secret); err != nil {
+		return "", err
+	}
+	return scanner.HashSecret(salt, secret), nil
+}
+
+// historyCommand prints every status change of a finding, with who made it and when
+func historyCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: lobster-pot history <fid>")
+	}
+
+	events, err := db.GetFindingHistory(args[0])
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no history for finding %s", args[0])
+	}
+
+	status := func(s int) string {
+		if s < 0 || s >= len(db.FindingValues) {
+			return "-"
+		}
+		return db.FindingValues[s]
+	}
+	for _, e := range events {
+		fmt.Printf("%s\t%s -> %s\tsource=%s\tactor=%s (%s)\tcomment=%s\n",
+			time.Unix(int64(e.Created), 0).UTC().Format(time.RFC3339), status(e.OldStatus), status(e.NewStatus),
+			e.Actor.Source, e.Actor.ID, e.Actor.Name, e.Comment)
+	}
+
+	occurrences, err := db.GetOccurrences(args[0])
+	if err != nil {
+		return err
+	}
+	for _, o := range occurrences {
+		fmt.Printf("%s\tseen in %s line %s\tpusher=%s\n",
+			time.Unix(int64(o.Seen), 0).UTC().Format(time.RFC3339), o.SHA, o.Line, o.Pusher)
+	}
+	return nil
+}
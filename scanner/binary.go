@@ -6,77 +6,159 @@ package scanner
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/salesforce/lobster-pot/config"
 	log "github.com/sirupsen/logrus"
 )
 
-type BinaryScannerOutput struct {
-	cmdOutput   []byte
-	scannerName string
+// Limits of the output kept for a binary scanner. The findings are lost if stdout
+// goes over the limit, only the end of stderr is kept.
+const (
+	maxScannerOutput = 64 * 1024 * 1024
+	maxScannerStderr = 16 * 1024
+)
+
+// binaryEngine runs an external binary, and parses its output with the parser registered for the scanner name
+type binaryEngine struct {
+	sc    config.Scanner
+	parse Parser
+}
+
+func (e binaryEngine) Name() string {
+	return e.sc.Name
 }
 
-func scanBinary(tmpFolder string, c config.Config) (findings []Finding, err error) {
-	b := c.Scanner.Binary
+func (e binaryEngine) Scan(ctx context.Context, tmpFolder string) (findings Findings, err error) {
+	sc := e.sc
+	b := sc.Binary
 
 	// Building arguments for the binary, which is a bit ugly.
 	// replace %s with the tmpFolder
-	argstring := c.Scanner.Arguments
+	argstring := sc.Arguments
 	args := fmt.Sprintf(argstring, tmpFolder)
 	a := strings.Split(args, ";")
 
 	cmd := exec.Command(b, a...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
+	setProcessGroup(cmd)
+	out := &limitedBuffer{limit: maxScannerOutput}
+	stderr := &limitedBuffer{limit: maxScannerStderr, keepTail: true}
+	cmd.Stdout = out
+	cmd.Stderr = stderr
 
 	log.WithFields(log.Fields{
-		"scanner": c.Scanner.Name,
-		"type":    c.Scanner.Type,
+		"scanner": sc.Name,
+		"type":    sc.Type,
 		"binary":  b,
 		"args":    a,
 	}).Debug("Running scanner")
 
-	if err := cmd.Run(); err != nil {
-		log.Trace(string(out.Bytes()))
-		log.Error(err)
-		return nil, err
+	err = run(ctx, cmd)
+	if ctx.Err() != nil {
+		return nil, &ScanError{Scanner: sc.Name, Err: ctx.Err(), Stderr: stderr.String()}
 	}
-
-	// Parse output
-	s := BinaryScannerOutput{
-		cmdOutput:   out.Bytes(),
-		scannerName: c.Scanner.Name,
+	if err != nil && !e.hasFindings(err) {
+		log.Trace(out.String())
+		log.WithFields(log.Fields{"scanner": sc.Name, "stderr": stderr.String()}).Error(err)
+		return nil, &ScanError{Scanner: sc.Name, Err: err, Stderr: stderr.String()}
+	}
+	if out.truncated {
+		return nil, &ScanError{Scanner: sc.Name, Err: fmt.Errorf("output is bigger than %d bytes", maxScannerOutput), Stderr: stderr.String()}
 	}
-
-	findings, err = parseFindingsFromBinaryScanner(s)
-
-	return findings, err
-
-}
-
-func parseFindingsFromBinaryScanner(s BinaryScannerOutput) (f []Finding, err error) {
 
 	log.WithFields(log.Fields{
-		"scanner": s.scannerName,
+		"scanner": sc.Name,
 	}).Debug("parsing findings")
 
 	log.WithFields(log.Fields{
-		"output": (string)(s.cmdOutput),
+		"output": out.String(),
 	}).Trace()
 
-	switch s.scannerName {
-	case "grover":
-		f, err = ParseGroverFindings(s.cmdOutput)
-	case "semgrep":
-		f, err = ParseSemgrepFindings(s.cmdOutput)
-	default:
-		err = fmt.Errorf("unknown binary scanner: %s", s.scannerName)
+	findings, err = e.parse(out.Bytes())
+	if err != nil {
+		return nil, &ScanError{Scanner: sc.Name, Err: fmt.Errorf("could not parse output: %s", err), Stderr: stderr.String()}
+	}
+
+	// some scanners report the paths relative to the scanned folder
+	for i, f := range findings {
+		if !filepath.IsAbs(f.FilePath) {
+			findings[i].FilePath = filepath.Join(tmpFolder, f.FilePath)
+		}
+	}
+
+	return findings, nil
+}
 
+// hasFindings returns true if the binary exited with one of the codes meaning findings were found
+func (e binaryEngine) hasFindings(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	code := exitErr.ExitCode()
+	for _, c := range e.sc.FindingsExitCodes {
+		if c == code {
+			return true
+		}
 	}
+	return false
+}
 
-	return f, err
+// run runs the command, killing its whole process group when the context is done
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
 
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				log.WithFields(log.Fields{"pid": cmd.Process.Pid}).Error("Could not kill scanner ", err)
+			}
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// limitedBuffer is a bytes.Buffer holding at most limit bytes. Either the first or the
+// last bytes written are kept.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	keepTail  bool
+	truncated bool
+}
+
+// Write never fails, so the command isn't stopped by a broken pipe when the limit is reached
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.keepTail {
+		b.Buffer.Write(p)
+		if over := b.Len() - b.limit; over > 0 {
+			b.Next(over)
+			b.truncated = true
+		}
+		return n, nil
+	}
+
+	room := b.limit - b.Len()
+	if room < len(p) {
+		b.truncated = true
+		if room <= 0 {
+			return n, nil
+		}
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
 }
@@ -0,0 +1,199 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Enrichment holds the facts decoded offline from the secret of a finding
+type Enrichment struct {
+	AWSAccountID string   // account owning an AWS access key
+	JWT          *JWTInfo // claims of a JSON Web Token
+	Key          *KeyInfo // details of a PEM private key
+}
+
+type JWTInfo struct {
+	Issuer    string
+	Audience  []string
+	Subject   string
+	ExpiresAt time.Time // zero if the token has no expiry
+	Expired   bool
+}
+
+type KeyInfo struct {
+	Type        string // RSA, ECDSA, Ed25519, or "encrypted" if the key is protected by a passphrase
+	Size        int    // in bits
+	Fingerprint string // SHA256 fingerprint of the public key, as shown by ssh-keygen
+}
+
+var (
+	awsAccessKeyRe = regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z2-7]{16}\b`)
+	jwtRe          = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	pemBeginRe     = regexp.MustCompile(`-----BEGIN ((?:[A-Z]+ )?PRIVATE KEY)-----`)
+)
+
+// Enrich decodes what can be learnt from the secret of a finding, without any network call.
+// PEM keys are read from the scanned file when the finding only holds their first line.
+func Enrich(f Finding) Enrichment {
+	var e Enrichment
+
+	if id := awsAccessKeyRe.FindString(f.Secret); id != "" {
+		e.AWSAccountID = awsAccountID(id)
+	}
+	if t := jwtRe.FindString(f.Secret); t != "" {
+		e.JWT = parseJWT(t, time.Now())
+	}
+	if pemBeginRe.MatchString(f.Secret) {
+		e.Key = parsePrivateKey(f)
+	}
+
+	return e
+}
+
+// IsEmpty returns true if nothing was decoded
+func (e Enrichment) IsEmpty() bool {
+	return e.AWSAccountID == "" && e.JWT == nil && e.Key == nil
+}
+
+// awsAccountID decodes the ID of the account owning an access key: the key ID, without its
+// prefix, is base32 encoded, and the account ID is stored in bits 7 to 46 of its first 6 bytes
+func awsAccountID(keyID string) string {
+	b, err := base32.StdEncoding.DecodeString(keyID[4:])
+	if err != nil || len(b) < 6 {
+		return ""
+	}
+	n := binary.BigEndian.Uint64(append([]byte{0, 0}, b[:6]...))
+	return fmt.Sprintf("%012d", (n&0x7fffffffff80)>>7)
+}
+
+func parseJWT(token string, now time.Time) *JWTInfo {
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	var claims struct {
+		Issuer   string          `json:"iss"`
+		Audience json.RawMessage `json:"aud"`
+		Subject  string          `json:"sub"`
+		Expiry   json.Number     `json:"exp"`
+	}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	if err := d.Decode(&claims); err != nil {
+		return nil
+	}
+
+	info := &JWTInfo{Issuer: claims.Issuer, Subject: claims.Subject}
+
+	// the audience is either a string or a list of strings
+	var aud string
+	if json.Unmarshal(claims.Audience, &aud) == nil && aud != "" {
+		info.Audience = []string{aud}
+	} else {
+		json.Unmarshal(claims.Audience, &info.Audience)
+	}
+
+	if exp, err := claims.Expiry.Float64(); err == nil && exp > 0 {
+		info.ExpiresAt = time.Unix(int64(exp), 0).UTC()
+		info.Expired = info.ExpiresAt.Before(now)
+	}
+
+	return info
+}
+
+// parsePrivateKey parses the PEM block of the finding, reading it from the scanned file
+// if the scanner only reported its first line
+func parsePrivateKey(f Finding) *KeyInfo {
+	data := []byte(f.Secret[strings.Index(f.Secret, "-----BEGIN"):])
+	block, _ := pem.Decode(data)
+	if block == nil {
+		content, err := ioutil.ReadFile(f.FilePath)
+		if err != nil {
+			return nil
+		}
+		begin := pemBeginRe.FindIndex(content)
+		if start, _, err := f.Lines(); err == nil {
+			// look for the key starting on the line of the finding, a file can hold several keys
+			if i := lineOffset(content, start); i >= 0 {
+				if loc := pemBeginRe.FindIndex(content[i:]); loc != nil {
+					begin = []int{i + loc[0], i + loc[1]}
+				}
+			}
+		}
+		if begin == nil {
+			return nil
+		}
+		block, _ = pem.Decode(content[begin[0]:])
+		if block == nil {
+			return nil
+		}
+	}
+
+	key, err := ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+	if err != nil {
+		if _, ok := err.(*ssh.PassphraseMissingError); ok || x509Encrypted(block) {
+			return &KeyInfo{Type: "encrypted"}
+		}
+		return nil
+	}
+
+	info := &KeyInfo{}
+	var pub interface{}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		info.Type, info.Size, pub = "RSA", k.N.BitLen(), &k.PublicKey
+	case *ecdsa.PrivateKey:
+		info.Type, info.Size, pub = "ECDSA", k.Curve.Params().BitSize, &k.PublicKey
+	case *ed25519.PrivateKey:
+		info.Type, info.Size, pub = "Ed25519", 256, k.Public()
+	case ed25519.PrivateKey:
+		info.Type, info.Size, pub = "Ed25519", 256, k.Public()
+	default:
+		info.Type = fmt.Sprintf("%T", key)
+		return info
+	}
+
+	if sshPub, err := ssh.NewPublicKey(pub); err == nil {
+		info.Fingerprint = ssh.FingerprintSHA256(sshPub)
+	}
+	return info
+}
+
+// x509Encrypted returns true for the legacy encrypted PEM blocks, and the encrypted PKCS#8 keys
+func x509Encrypted(block *pem.Block) bool {
+	_, ok := block.Headers["DEK-Info"]
+	return ok || block.Type == "ENCRYPTED PRIVATE KEY"
+}
+
+// lineOffset returns the offset of the first byte of the line, numbered from 1
+func lineOffset(content []byte, line int) int {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return -1
+		}
+		offset += i + 1
+	}
+	return offset
+}
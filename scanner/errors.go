@@ -0,0 +1,37 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScanError is the failure of a scanner
+type ScanError struct {
+	Scanner  string
+	Err      error
+	Stderr   string // end of the scanner's stderr, for binary scanners
+	TimedOut bool
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Scanner, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanErrors are the failures of the scanners of a scan
+type ScanErrors []*ScanError
+
+func (e ScanErrors) Error() string {
+	names := make([]string, len(e))
+	for i, se := range e {
+		names[i] = se.Scanner
+	}
+	return fmt.Sprintf("scanners failed: %s", strings.Join(names, ", "))
+}
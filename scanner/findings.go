@@ -6,14 +6,25 @@ package scanner
 
 import (
 	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type Finding struct {
-	FilePath        string `json:"file_path"`
-	LineNumber      string `json:"line_number"`
-	RuleDescription string `json:"rule_description"`
-	Scanner         string `json:"scanner"`
-	Secret          string `json:"secret"`
+	FilePath        string   `json:"file_path"`
+	LineNumber      string   `json:"line_number"`
+	RuleDescription string   `json:"rule_description"`
+	RuleID          string   `json:"rule_id"`
+	Level           string   `json:"level,omitempty"` // Severity reported by the scanner, if any
+	Scanner         string   `json:"scanner"`
+	Scanners        []string `json:"scanners"` // All the scanners that reported the finding
+	Secret          string   `json:"secret"`
+	Verified        bool     `json:"verified,omitempty"`   // The scanner checked the secret is live
+	TokenType       string   `json:"token_type,omitempty"` // Type of token found in the secret, if known
+	Format          string   `json:"format,omitempty"`     // well-formed or malformed, for known token types
+	Known           bool     `json:"known,omitempty"`      // The secret is registered as a real secret
 }
 
 type Findings []Finding
@@ -25,3 +36,74 @@ func (f Findings) String() string {
 	}
 	return string(b)
 }
+
+// Lines returns the first and last line of the finding. Scanners report either
+// a single line ("12") or a range for multiline findings ("12-14").
+func (f Finding) Lines() (start int, end int, err error) {
+	parts := strings.SplitN(f.LineNumber, "-", 2)
+	start, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid line number %q", f.LineNumber)
+	}
+	end = start
+	if len(parts) == 2 {
+		end, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid line number %q", f.LineNumber)
+		}
+	}
+	return start, end, nil
+}
+
+// MergeFindings de-duplicates the findings reported on the same file, line and secret,
+// by one or several scanners. The merged finding lists every scanner that reported it.
+func MergeFindings(findings Findings) Findings {
+	merged := Findings{}
+	index := make(map[string]int)
+
+	for _, f := range findings {
+		if len(f.Scanners) == 0 {
+			f.Scanners = []string{f.Scanner}
+		}
+
+		// multiline findings are merged on their first line, since scanners don't agree on where they end
+		start, _, err := f.Lines()
+		if err != nil {
+			merged = append(merged, f)
+			continue
+		}
+		key := fmt.Sprintf("%s:%d:%s", filepath.Clean(f.FilePath), start, strings.TrimSpace(f.Secret))
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, f)
+			continue
+		}
+
+		m := &merged[i]
+		for _, s := range f.Scanners {
+			if !contains(m.Scanners, s) {
+				m.Scanners = append(m.Scanners, s)
+			}
+		}
+		m.Verified = m.Verified || f.Verified
+		if m.Level == "" {
+			m.Level = f.Level
+		}
+		if f.RuleDescription != "" && !strings.Contains(m.RuleDescription, f.RuleDescription) {
+			m.RuleDescription = fmt.Sprintf("%s; %s", m.RuleDescription, f.RuleDescription)
+		}
+	}
+
+	return merged
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
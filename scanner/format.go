@@ -0,0 +1,128 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+// Format of the token found in a finding
+const (
+	FormatWellFormed = "well-formed"
+	FormatMalformed  = "malformed"
+)
+
+// Policies for the malformed findings
+const (
+	MalformedMark = "mark" // report them with a low-confidence marker
+	MalformedDrop = "drop" // don't report them
+)
+
+// tokenFormat finds the tokens of a type in a secret, with a loose regexp, and validates each of them
+type tokenFormat struct {
+	name      string
+	candidate *regexp.Regexp
+	valid     func(token string) bool
+}
+
+var tokenFormats = []tokenFormat{
+	{
+		name:      "GitHub token",
+		candidate: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9_]+`),
+		valid:     validGithubToken,
+	},
+	{
+		name:      "GitHub fine-grained token",
+		candidate: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]+`),
+		valid:     regexp.MustCompile(`^github_pat_[A-Za-z0-9]{22}_[A-Za-z0-9]{59}$`).MatchString,
+	},
+	{
+		name:      "Slack token",
+		candidate: regexp.MustCompile(`\bxox[abposre]-[A-Za-z0-9-]+`),
+		valid:     validSlackToken,
+	},
+	{
+		name:      "AWS access key ID",
+		candidate: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Za-z0-9]+`),
+		valid:     regexp.MustCompile(`^(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z2-7]{16}$`).MatchString,
+	},
+}
+
+var slackTokenFormats = []*regexp.Regexp{
+	regexp.MustCompile(`^xoxb-[0-9]{8,13}-[0-9]{8,13}-[A-Za-z0-9]{24}$`),
+	regexp.MustCompile(`^xoxp-[0-9]{8,13}-[0-9]{8,13}-[0-9]{8,13}-[a-f0-9]{32}$`),
+	regexp.MustCompile(`^xox[aors]-[0-9]+-[0-9A-Za-z]+(?:-[0-9A-Za-z]+)*$`),
+	regexp.MustCompile(`^xoxe-[0-9]+-[0-9A-Za-z]+(?:-[0-9A-Za-z]+)*$`),
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// validGithubToken checks the layout of a GitHub token: a prefix, 30 random characters,
+// and the CRC32 of the random characters, encoded in base62 on 6 characters.
+func validGithubToken(token string) bool {
+	parts := strings.SplitN(token, "_", 2)
+	if len(parts) != 2 || len(parts[1]) != 36 {
+		return false
+	}
+	random, checksum := parts[1][:30], parts[1][30:]
+	return base62(crc32.ChecksumIEEE([]byte(random)), 6) == checksum
+}
+
+func validSlackToken(token string) bool {
+	for _, re := range slackTokenFormats {
+		if re.MatchString(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// base62 encodes n, left-padded with zeros to width characters
+func base62(n uint32, width int) string {
+	var b []byte
+	for n > 0 {
+		b = append([]byte{base62Alphabet[n%62]}, b...)
+		n /= 62
+	}
+	for len(b) < width {
+		b = append([]byte{'0'}, b...)
+	}
+	return string(b)
+}
+
+// CheckFormat returns the type of token found in the secret of the finding, and whether
+// it is well-formed. A secret holding several tokens of the type is well-formed if any of them is.
+// It returns empty strings if no known token type is found.
+func CheckFormat(f Finding) (tokenType string, format string) {
+	for _, tf := range tokenFormats {
+		tokens := tf.candidate.FindAllString(f.Secret, -1)
+		if len(tokens) == 0 {
+			continue
+		}
+		for _, t := range tokens {
+			if tf.valid(t) {
+				return tf.name, FormatWellFormed
+			}
+		}
+		return tf.name, FormatMalformed
+	}
+	return "", ""
+}
+
+// ValidateFindings tags the findings holding a known token type as well-formed or malformed.
+// With the MalformedDrop policy, the malformed findings are removed.
+func ValidateFindings(findings Findings, policy string) Findings {
+	validated := Findings{}
+	for _, f := range findings {
+		f.TokenType, f.Format = CheckFormat(f)
+		if f.Format == FormatMalformed && policy == MalformedDrop {
+			continue
+		}
+		validated = append(validated, f)
+	}
+	return validated
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type gitleaksFinding struct {
+	Description string   `json:"Description"`
+	StartLine   int      `json:"StartLine"`
+	EndLine     int      `json:"EndLine"`
+	StartColumn int      `json:"StartColumn"`
+	EndColumn   int      `json:"EndColumn"`
+	Match       string   `json:"Match"`
+	Secret      string   `json:"Secret"`
+	File        string   `json:"File"`
+	Commit      string   `json:"Commit"`
+	Entropy     float64  `json:"Entropy"`
+	Tags        []string `json:"Tags"`
+	RuleID      string   `json:"RuleID"`
+	Fingerprint string   `json:"Fingerprint"`
+}
+
+type gitleaksFindings []gitleaksFinding
+
+func init() {
+	RegisterParser("gitleaks", ParseGitleaksFindings)
+}
+
+// ParseGitleaksFindings parses the JSON report of gitleaks
+func ParseGitleaksFindings(data []byte) (Findings, error) {
+	var gf gitleaksFindings
+	err := json.Unmarshal(data, &gf)
+	if err != nil {
+		return nil, err
+	}
+
+	f := make(Findings, len(gf))
+	for i, g := range gf {
+
+		// proper formatting of the line number in case of multiline findings
+		ln := fmt.Sprintf("%d", g.StartLine)
+		if g.EndLine > g.StartLine {
+			ln = fmt.Sprintf("%d-%d", g.StartLine, g.EndLine)
+		}
+		f[i] = Finding{
+			FilePath:        g.File,
+			LineNumber:      ln,
+			RuleDescription: g.Description,
+			RuleID:          g.RuleID,
+			Scanner:         "gitleaks",
+			Secret:          g.Secret,
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/salesforce/lobster-pot/config"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Parts of a file a rule can match
+const (
+	partExtension = "partextension"
+	partFilename  = "partfilename"
+	partPath      = "partpath"
+	partContent   = "partcontent"
+)
+
+// files bigger than this are only matched on their name, not their content
+const maxContentSize = 10 * 1024 * 1024
+
+// rulesFile is the format of rules/default_rules.yml
+type rulesFile struct {
+	Meta struct {
+		Version string `yaml:"version"`
+	} `yaml:"Meta"`
+	SimpleSignatures       []ruleDef `yaml:"SimpleSignatures"`
+	PatternSignatures      []ruleDef `yaml:"PatternSignatures"`
+	SafeFunctionSignatures []ruleDef `yaml:"SafeFunctionSignatures"`
+}
+
+type ruleDef struct {
+	Part        string  `yaml:"part"`
+	Match       string  `yaml:"match"`
+	Description string  `yaml:"description"`
+	RuleID      string  `yaml:"ruleid"`
+	Enable      int     `yaml:"enable"`
+	Entropy     float64 `yaml:"entropy"`
+	MatchLevel  int     `yaml:"match-level"`
+}
+
+// rule is a compiled ruleDef. Simple rules compare match with the part of the file,
+// pattern and safe rules use the compiled regexp.
+type rule struct {
+	part        string
+	match       string
+	re          *regexp.Regexp
+	description string
+	id          string
+	entropy     float64
+}
+
+type ruleSet struct {
+	simple  []rule
+	pattern []rule
+	safe    []rule
+}
+
+var loadedRules = make(map[string]*ruleSet)
+var loadedRulesMu sync.Mutex
+
+func init() {
+	RegisterEngine("golang", func(s config.Scanner) (Engine, error) {
+		return engineFunc{
+			name: "golang",
+			scan: func(ctx context.Context, dir string) (Findings, error) { return scanGolang(ctx, dir, s) },
+		}, nil
+	})
+}
+
+// scanGolang runs the rules of the scanner's rules file on every file of tmpFolder, until the context is done
+func scanGolang(ctx context.Context, tmpFolder string, s config.Scanner) (Findings, error) {
+	rs, err := loadRules(s.RulesFile, s.MatchLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := Findings{}
+	err = filepath.Walk(tmpFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(tmpFolder, path)
+		if err != nil {
+			return err
+		}
+		f, err := rs.scanFile(path, filepath.ToSlash(rel), info)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, f...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return findings, nil
+}
+
+// scanFile matches the rules against the name and the content of a file
+func (rs *ruleSet) scanFile(path, rel string, info os.FileInfo) (Findings, error) {
+	findings := Findings{}
+	name := filepath.Base(rel)
+
+	parts := map[string]string{
+		partExtension: filepath.Ext(name),
+		partFilename:  name,
+		partPath:      rel,
+	}
+
+	// the whole file is the secret for rules matching its name, so they are reported on the first line
+	newFileFinding := func(r rule) Finding {
+		return Finding{
+			FilePath:        path,
+			LineNumber:      "1",
+			RuleDescription: r.description,
+			RuleID:          r.id,
+			Scanner:         "golang",
+			Secret:          rel,
+		}
+	}
+
+	for _, r := range rs.simple {
+		if r.part != partContent && parts[r.part] == r.match {
+			findings = append(findings, newFileFinding(r))
+		}
+	}
+
+	// content is only read when a content rule is enabled, and stays nil for binary and big files
+	var content []byte
+	contentRead := false
+	for _, r := range rs.pattern {
+		if r.part != partContent {
+			if r.re.MatchString(parts[r.part]) {
+				findings = append(findings, newFileFinding(r))
+			}
+			continue
+		}
+
+		if !contentRead {
+			contentRead = true
+			if info.Size() > maxContentSize {
+				log.WithFields(log.Fields{"file": rel, "size": info.Size()}).Debug("File too big, skipping content")
+			} else {
+				c, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				if !isBinary(c) {
+					content = c
+				}
+			}
+		}
+		if content == nil {
+			continue
+		}
+
+		for _, loc := range r.re.FindAllSubmatchIndex(content, -1) {
+			match := string(content[loc[0]:loc[1]])
+			// entropy is computed on the captured value when the rule has a group
+			value := match
+			if len(loc) >= 4 && loc[2] >= 0 {
+				value = string(content[loc[2]:loc[3]])
+			}
+			if r.entropy > 0 && shannonEntropy(value) < r.entropy {
+				continue
+			}
+			if rs.isSafe(match) {
+				continue
+			}
+
+			start := bytes.Count(content[:loc[0]], []byte("\n")) + 1
+			end := start + strings.Count(strings.TrimSuffix(match, "\n"), "\n")
+			ln := fmt.Sprintf("%d", start)
+			if end != start {
+				ln = fmt.Sprintf("%d-%d", start, end)
+			}
+
+			findings = append(findings, Finding{
+				FilePath:        path,
+				LineNumber:      ln,
+				RuleDescription: r.description,
+				RuleID:          r.id,
+				Scanner:         "golang",
+				Secret:          strings.TrimSpace(match),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// isSafe returns true if the match is a known false positive, according to the safe function rules
+func (rs *ruleSet) isSafe(match string) bool {
+	for _, r := range rs.safe {
+		if r.re.MatchString(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRules parses the rules file, keeping the enabled rules with a match level of at least level.
+// Rules are only parsed once per file and level.
+func loadRules(path string, level int) (*ruleSet, error) {
+	key := fmt.Sprintf("%s:%d", path, level)
+
+	loadedRulesMu.Lock()
+	defer loadedRulesMu.Unlock()
+	if rs, ok := loadedRules[key]; ok {
+		return rs, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rf rulesFile
+	err = yaml.Unmarshal(data, &rf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %s", path, err)
+	}
+
+	rs := &ruleSet{}
+	rs.simple, err = compileRules(rf.SimpleSignatures, level, false)
+	if err != nil {
+		return nil, err
+	}
+	rs.pattern, err = compileRules(rf.PatternSignatures, level, true)
+	if err != nil {
+		return nil, err
+	}
+	rs.safe, err = compileRules(rf.SafeFunctionSignatures, level, true)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"rulesFile": path,
+		"version":   rf.Meta.Version,
+		"simple":    len(rs.simple),
+		"pattern":   len(rs.pattern),
+		"safe":      len(rs.safe),
+	}).Debug("Rules loaded")
+
+	loadedRules[key] = rs
+	return rs, nil
+}
+
+func compileRules(defs []ruleDef, level int, isRegexp bool) ([]rule, error) {
+	var rules []rule
+	for _, d := range defs {
+		if d.Enable == 0 || d.MatchLevel < level {
+			continue
+		}
+		r := rule{
+			part:        strings.ToLower(d.Part),
+			match:       d.Match,
+			description: d.Description,
+			id:          d.RuleID,
+			entropy:     d.Entropy,
+		}
+		switch r.part {
+		case partExtension, partFilename, partPath, partContent:
+		default:
+			return nil, fmt.Errorf("unknown part %s for rule %s", d.Part, d.RuleID)
+		}
+		if isRegexp {
+			re, err := regexp.Compile(d.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp for rule %s: %s", d.RuleID, err)
+			}
+			r.re = re
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// shannonEntropy returns the Shannon entropy of s, in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]float64)
+	total := 0.0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	e := 0.0
+	for _, c := range counts {
+		p := c / total
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000 bytes
+func isBinary(content []byte) bool {
+	n := len(content)
+	if n > 8000 {
+		n = 8000
+	}
+	return bytes.IndexByte(content[:n], 0) != -1
+}
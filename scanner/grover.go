@@ -30,6 +30,10 @@ type groverFinding struct {
 
 type groverFindings []groverFinding
 
+func init() {
+	RegisterParser("grover", ParseGroverFindings)
+}
+
 func ParseGroverFindings(data []byte) (Findings, error) {
 	var gf groverFindings
 	err := json.Unmarshal(data, &gf)
@@ -43,6 +47,7 @@ func ParseGroverFindings(data []byte) (Findings, error) {
 			FilePath:        g.FilePath,
 			LineNumber:      g.LineNumber,
 			RuleDescription: g.Description,
+			RuleID:          g.Ruleid,
 			Scanner:         "grover",
 			Secret:          g.Comment,
 		}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// MinKnownSecretLength is the length of the shortest token hashed, no real secret is shorter
+const MinKnownSecretLength = 6
+
+// MaxKnownSecretDelimiters is the largest number of delimiters a secret can contain, see secretTokens
+const MaxKnownSecretDelimiters = 8
+
+// HashSecret returns the salted hash of a secret, as stored in the known secrets registry
+func HashSecret(salt, secret string) string {
+	h := hmac.New(sha256.New, []byte(salt))
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HoneytokenRuleID is the rule of the findings reported by FindHoneytokens
+const HoneytokenRuleID = "honeytoken"
+
+// FindKnownSecrets hashes every token of the files of tmpFolder, and reports the ones found
+// in known, the names of the registered secrets by hash. The secret of the findings is
+// the hash, so the plaintext is never stored nor displayed.
+func FindKnownSecrets(tmpFolder, salt string, known map[string]string) (Findings, error) {
+	if len(known) == 0 {
+		return Findings{}, nil
+	}
+	return findHashedTokens(tmpFolder, salt, func(hash string) (Finding, bool) {
+		name, ok := known[hash]
+		return Finding{
+			RuleDescription: fmt.Sprintf("Known secret: %s", name),
+			RuleID:          "known-secret",
+			Level:           "critical",
+			Scanner:         "known-secrets",
+			Secret:          fmt.Sprintf("known-secret:%s", hash),
+			Known:           true,
+		}, ok
+	})
+}
+
+// FindHoneytokens hashes every token of the files of tmpFolder, and reports the ones found in honeytokens,
+// the hashes of the registered honeytokens. The secret of the findings is the hash, see HoneytokenHash.
+func FindHoneytokens(tmpFolder, salt string, honeytokens map[string]bool) (Findings, error) {
+	if len(honeytokens) == 0 {
+		return Findings{}, nil
+	}
+	return findHashedTokens(tmpFolder, salt, func(hash string) (Finding, bool) {
+		return Finding{
+			RuleDescription: "Honeytoken",
+			RuleID:          HoneytokenRuleID,
+			Level:           "critical",
+			Scanner:         "honeytokens",
+			Secret:          fmt.Sprintf("%s:%s", HoneytokenRuleID, hash),
+		}, honeytokens[hash]
+	})
+}
+
+// HoneytokenHash returns the hash of the honeytoken of a finding reported by FindHoneytokens
+func HoneytokenHash(f Finding) (string, bool) {
+	if f.RuleID != HoneytokenRuleID {
+		return "", false
+	}
+	return strings.TrimPrefix(f.Secret, HoneytokenRuleID+":"), true
+}
+
+// findHashedTokens hashes every token of the text files of tmpFolder, and reports the findings
+// that match returns for their hash, at the path and line of the token
+func findHashedTokens(tmpFolder, salt string, match func(hash string) (Finding, bool)) (Findings, error) {
+	findings := Findings{}
+	err := filepath.Walk(tmpFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Size() > maxContentSize {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isBinary(content) {
+			return nil
+		}
+
+		s := bufio.NewScanner(bytes.NewReader(content))
+		s.Buffer(make([]byte, 64*1024), maxContentSize)
+		line := 0
+		for s.Scan() {
+			line++
+			for _, token := range secretTokens(s.Text()) {
+				f, ok := match(HashSecret(salt, token))
+				if !ok {
+					continue
+				}
+				f.FilePath = path
+				f.LineNumber = fmt.Sprintf("%d", line)
+				findings = append(findings, f)
+			}
+		}
+		return s.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return findings, nil
+}
+
+// secretDelimiters are the quotes, assignment and structure characters a secret is usually written between
+const secretDelimiters = "\"'`=,;:()[]{}<>"
+
+// secretTokens splits a line on spaces, and returns the distinct substrings of each field that start
+// and end at a delimiter, or at the edge of the field, and are long enough to be a secret.
+// A substring spans at most MaxKnownSecretDelimiters delimiters, so the secrets containing
+// some of them, like the padding of base64 keys or a password with a colon, are still tokens
+// of the line they are written in.
+func secretTokens(line string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, field := range strings.Fields(line) {
+		var delims []int
+		for i, r := range field {
+			if strings.ContainsRune(secretDelimiters, r) {
+				delims = append(delims, i)
+			}
+		}
+
+		// the tokens start at the beginning of the field or after a delimiter, and end at
+		// the next delimiters or at the end of the field
+		first := 0
+		for start := 0; start <= len(field); {
+			for first < len(delims) && delims[first] < start {
+				first++
+			}
+			for m := first; m <= len(delims) && m-first <= MaxKnownSecretDelimiters; m++ {
+				end := len(field)
+				if m < len(delims) {
+					end = delims[m]
+				}
+				token := field[start:end]
+				if len(token) < MinKnownSecretLength || seen[token] {
+					continue
+				}
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+			if first == len(delims) {
+				break
+			}
+			start = delims[first] + 1
+		}
+	}
+	return tokens
+}
+
+// ValidateKnownSecret returns an error if a secret can't be registered, because secretTokens
+// would never return it
+func ValidateKnownSecret(secret string) error {
+	if len(secret) < MinKnownSecretLength {
+		return fmt.Errorf("the secret must be at least %d characters long", MinKnownSecretLength)
+	}
+	if strings.IndexFunc(secret, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("the secret can't contain spaces, the files are split on them")
+	}
+	n := 0
+	for _, r := range secret {
+		if strings.ContainsRune(secretDelimiters, r) {
+			n++
+		}
+	}
+	if n > MaxKnownSecretDelimiters {
+		return fmt.Errorf("the secret can't contain more than %d of the %s characters", MaxKnownSecretDelimiters, secretDelimiters)
+	}
+	return nil
+}
+
+// SecretHashes returns the salted hashes of the secret of a finding and of each of its tokens,
+// since scanners often report the whole line holding the secret
+func SecretHashes(salt string, f Finding) []string {
+	secret := strings.TrimSpace(f.Secret)
+	hashes := []string{HashSecret(salt, secret)}
+	for _, token := range secretTokens(secret) {
+		if token != secret {
+			hashes = append(hashes, HashSecret(salt, token))
+		}
+	}
+	return hashes
+}
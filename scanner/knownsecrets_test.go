@@ -0,0 +1,84 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testKnownSecretsSalt = "0123456789abcdef"
+
+func TestFindKnownSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		content string
+		found   bool
+	}{
+		{name: "plain token", secret: "hunter2hunter2", content: "password hunter2hunter2\n", found: true},
+		{name: "padded base64", secret: "c2hhcmVka2V5MTIzNA==", content: "SHARED_KEY=c2hhcmVka2V5MTIzNA==\n", found: true},
+		{name: "quoted padded base64", secret: "c2hhcmVka2V5MTIzNA==", content: `{"key": "c2hhcmVka2V5MTIzNA=="},` + "\n", found: true},
+		{name: "key=value secret", secret: "s3cr3t=Pass;word", content: "db:\n  password: s3cr3t=Pass;word\n", found: true},
+		{name: "quoted key=value secret", secret: "s3cr3t=Pass;word", content: `DB_PASSWORD="s3cr3t=Pass;word"` + "\n", found: true},
+		{name: "single quoted", secret: "s3cr3t:P4ss", content: "conn('admin', 's3cr3t:P4ss')\n", found: true},
+		{name: "on the second line", secret: "hunter2hunter2", content: "user: admin\npassword: hunter2hunter2\n", found: true},
+		{name: "prefix of a longer word", secret: "hunter2hunter2", content: "password: hunter2hunter2x\n", found: false},
+		{name: "part of the secret", secret: "s3cr3t=Pass;word", content: "password: s3cr3t=Pass\n", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateKnownSecret(tt.secret); err != nil {
+				t.Fatalf("secret refused: %v", err)
+			}
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			known := map[string]string{HashSecret(testKnownSecretsSalt, tt.secret): "test secret"}
+
+			findings, err := FindKnownSecrets(dir, testKnownSecretsSalt, known)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.found != (len(findings) == 1) {
+				t.Fatalf("findings = %+v, want found: %v", findings, tt.found)
+			}
+			if tt.found && findings[0].Secret != "known-secret:"+HashSecret(testKnownSecretsSalt, tt.secret) {
+				t.Errorf("secret = %s, want the hash", findings[0].Secret)
+			}
+
+			// the honeytokens are matched the same way
+			honeytokens := map[string]bool{HashSecret(testKnownSecretsSalt, tt.secret): true}
+			findings, err = FindHoneytokens(dir, testKnownSecretsSalt, honeytokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.found != (len(findings) == 1) {
+				t.Errorf("honeytoken findings = %+v, want found: %v", findings, tt.found)
+			}
+		})
+	}
+}
+
+func TestValidateKnownSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		valid  bool
+	}{
+		{secret: "c2hhcmVka2V5MTIzNA==", valid: true},
+		{secret: "s3cr3t=Pass;word", valid: true},
+		{secret: "short", valid: false},
+		{secret: "correct horse battery staple", valid: false},
+		{secret: "a=b=c=d=e=f=g=h=i=j", valid: false},
+	}
+	for _, tt := range tests {
+		if err := ValidateKnownSecret(tt.secret); (err == nil) != tt.valid {
+			t.Errorf("ValidateKnownSecret(%q) = %v, want valid: %v", tt.secret, err, tt.valid)
+		}
+	}
+}
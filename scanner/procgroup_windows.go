@@ -0,0 +1,22 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+//go:build windows
+// +build windows
+
+package scanner
+
+import "os/exec"
+
+// setProcessGroup is a no-op, process groups are not supported on windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup only kills the command, its children are left running
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
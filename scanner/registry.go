@@ -0,0 +1,125 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/salesforce/lobster-pot/config"
+)
+
+// Engine is a scanner looking for secrets in the files of a folder
+type Engine interface {
+	Name() string
+	Scan(ctx context.Context, dir string) (Findings, error)
+}
+
+// EngineFactory builds an embedded engine from its configuration
+type EngineFactory func(s config.Scanner) (Engine, error)
+
+// Parser parses the output of a binary scanner
+type Parser func(data []byte) (Findings, error)
+
+var (
+	registryMu sync.RWMutex
+	engines    = make(map[string]EngineFactory)
+	parsers    = make(map[string]Parser)
+)
+
+func init() {
+	config.SetScannerRegistry(registry{})
+}
+
+// RegisterEngine makes an embedded engine available as a "golang" scanner named name.
+// It is meant to be called from the init function of the package implementing the engine,
+// and panics if the name is already registered.
+func RegisterEngine(name string, factory EngineFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := engines[name]; dup {
+		panic("scanner: RegisterEngine called twice for " + name)
+	}
+	engines[name] = factory
+}
+
+// RegisterParser makes the output of a "binary" scanner named name parsable.
+// It is meant to be called from the init function of the package implementing the parser,
+// and panics if the name is already registered.
+func RegisterParser(name string, parser Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := parsers[name]; dup {
+		panic("scanner: RegisterParser called twice for " + name)
+	}
+	parsers[name] = parser
+}
+
+// NewEngine builds the engine of a configured scanner
+func NewEngine(s config.Scanner) (Engine, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	switch s.Type {
+	case "binary":
+		parser, ok := parsers[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown binary scanner: %s", s.Name)
+		}
+		return binaryEngine{sc: s, parse: parser}, nil
+
+	case "golang":
+		factory, ok := engines[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown Embedded scanner named: %s", s.Name)
+		}
+		return factory(s)
+	}
+
+	return nil, fmt.Errorf("unknown scanner type: %s", s.Type)
+}
+
+// registry lets the config package validate the scanners against the registered engines and parsers
+type registry struct{}
+
+func (registry) IsRegistered(stype, name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	switch stype {
+	case "binary":
+		_, ok := parsers[name]
+		return ok
+	case "golang":
+		_, ok := engines[name]
+		return ok
+	}
+	return false
+}
+
+// engineFunc turns a scanning function into an Engine. The function must return when the context is done,
+// so the deadline of the scans bounds every engine.
+type engineFunc struct {
+	name string
+	scan func(ctx context.Context, dir string) (Findings, error)
+}
+
+func (e engineFunc) Name() string {
+	return e.name
+}
+
+// Scan runs the scanning function. The findings of a function that completed after the context was done are discarded.
+func (e engineFunc) Scan(ctx context.Context, dir string) (Findings, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	findings, err := e.scan(ctx, dir)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return findings, err
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Subset of the SARIF 2.1.0 format used to build the findings.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+	DefaultConfig    struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex *int            `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region        sarifRegion `json:"region"`
+		ContextRegion sarifRegion `json:"contextRegion"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int          `json:"startLine"`
+	EndLine   int          `json:"endLine"`
+	Snippet   sarifMessage `json:"snippet"`
+}
+
+func init() {
+	RegisterParser("sarif", ParseSarifFindings)
+}
+
+// ParseSarifFindings parses a SARIF 2.1.0 log, with one finding per location of each result
+func ParseSarifFindings(data []byte) (Findings, error) {
+	var sl sarifLog
+	err := json.Unmarshal(data, &sl)
+	if err != nil {
+		return nil, err
+	}
+	if sl.Version != "" && sl.Version != "2.1.0" {
+		return nil, fmt.Errorf("unsupported SARIF version: %s", sl.Version)
+	}
+
+	f := Findings{}
+	for _, run := range sl.Runs {
+		name := strings.ToLower(run.Tool.Driver.Name)
+		if name == "" {
+			name = "sarif"
+		}
+
+		rules := make(map[string]sarifRule)
+		for _, r := range run.Tool.Driver.Rules {
+			rules[r.ID] = r
+		}
+
+		for _, res := range run.Results {
+			rule, ok := rules[res.RuleID]
+			if !ok && res.RuleIndex != nil && *res.RuleIndex >= 0 && *res.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*res.RuleIndex]
+			}
+			ruleID := res.RuleID
+			if ruleID == "" {
+				ruleID = rule.ID
+			}
+
+			// the level of a result defaults to the level of its rule, then to "warning"
+			level := res.Level
+			if level == "" {
+				level = rule.DefaultConfig.Level
+			}
+			if level == "" {
+				level = "warning"
+			}
+
+			description := res.Message.Text
+			if description == "" {
+				description = rule.ShortDescription.Text
+			}
+			if description == "" {
+				description = rule.FullDescription.Text
+			}
+
+			for _, loc := range res.Locations {
+				pl := loc.PhysicalLocation
+				if pl.ArtifactLocation.URI == "" {
+					continue
+				}
+
+				start := pl.Region.StartLine
+				if start == 0 {
+					start = 1
+				}
+				end := pl.Region.EndLine
+				if end < start {
+					end = start
+				}
+				ln := fmt.Sprintf("%d", start)
+				if start != end {
+					ln = fmt.Sprintf("%d-%d", start, end)
+				}
+
+				snippet := pl.Region.Snippet.Text
+				if snippet == "" {
+					snippet = pl.ContextRegion.Snippet.Text
+				}
+
+				f = append(f, Finding{
+					FilePath:        sarifPath(pl.ArtifactLocation.URI),
+					LineNumber:      ln,
+					RuleDescription: description,
+					RuleID:          ruleID,
+					Level:           level,
+					Scanner:         name,
+					Secret:          snippet,
+				})
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// sarifPath turns an artifact URI into a file path. URIs are either relative to the
+// scanned folder, or absolute file:// URIs.
+func sarifPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	if u.Scheme == "file" || u.Scheme == "" {
+		return u.Path
+	}
+	return uri
+}
@@ -5,20 +5,82 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
 	"github.com/salesforce/lobster-pot/config"
+	log "github.com/sirupsen/logrus"
 )
 
-// ScanFolder takes a path to a folder to scan, calls the scanning binary to do the scan
-// and returns a list of findings, and an error state.
+// ScanFolder takes a path to a folder to scan, runs all the configured scanners on it
+// and returns the merged list of findings, and an error state.
 func ScanFolder(tmpFolder string, c config.Config) (findings []Finding, err error) {
 
-	if c.Scanner.Type == "binary" {
-		findings, err = scanBinary(tmpFolder, c)
+	results := make([]Findings, len(c.Scanners))
+	errs := make([]error, len(c.Scanners))
+
+	// the scanners only read the folder, so they can run side by side
+	var wg sync.WaitGroup
+	for i, s := range c.Scanners {
+		wg.Add(1)
+		go func(i int, s config.Scanner) {
+			defer wg.Done()
+			results[i], errs[i] = scanWith(tmpFolder, s)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var failed ScanErrors
+	for i, e := range errs {
+		if e != nil {
+			log.WithFields(log.Fields{"scanner": c.Scanners[i].Name}).Error(e)
+			var se *ScanError
+			if !errors.As(e, &se) {
+				se = &ScanError{Scanner: c.Scanners[i].Name, Err: e}
+			}
+			failed = append(failed, se)
+			continue
+		}
+		findings = append(findings, results[i]...)
 	}
 
-	if c.Scanner.Type == "golang" {
-		findings, err = scanEmbeddedGo(tmpFolder, c.Scanner)
+	// a partial scan would silently miss secrets, so any failure fails the scan
+	if len(failed) > 0 {
+		return nil, failed
 	}
 
+	return MergeFindings(findings), nil
+}
+
+func scanWith(tmpFolder string, s config.Scanner) (findings []Finding, err error) {
+
+	e, err := NewEngine(s)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"scanner": e.Name(),
+		"type":    s.Type,
+	}).Debug("Scanning")
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	findings, err = e.Scan(ctx, tmpFolder)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		// keep the stderr of binary scanners
+		se := &ScanError{Scanner: s.Name}
+		errors.As(err, &se)
+		se.Err = fmt.Errorf("timed out after %s", s.Timeout)
+		se.TimedOut = true
+		return nil, se
+	}
 	return findings, err
 }
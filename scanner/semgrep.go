@@ -51,6 +51,10 @@ type semgrepMetadata struct {
 
 type semgrepMetavars struct{}
 
+func init() {
+	RegisterParser("semgrep", ParseSemgrepFindings)
+}
+
 func ParseSemgrepFindings(data []byte) (Findings, error) {
 	var sf semgrepFindings
 	err := json.Unmarshal(data, &sf)
@@ -76,6 +80,7 @@ func ParseSemgrepFindings(data []byte) (Findings, error) {
 			FilePath:        fnd.Path,
 			LineNumber:      ln,
 			RuleDescription: fnd.Extra.Message,
+			RuleID:          fnd.CheckID,
 			Scanner:         "semgrep",
 			Secret:          fnd.Extra.Lines,
 		}
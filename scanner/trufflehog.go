@@ -0,0 +1,77 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// trufflehogFinding is a line of the output of "trufflehog filesystem --json" (v3)
+type trufflehogFinding struct {
+	SourceMetadata struct {
+		Data struct {
+			Filesystem struct {
+				File string `json:"file"`
+				Line int    `json:"line"`
+			} `json:"Filesystem"`
+		} `json:"Data"`
+	} `json:"SourceMetadata"`
+	SourceName   string `json:"SourceName"`
+	DetectorType int    `json:"DetectorType"`
+	DetectorName string `json:"DetectorName"`
+	DecoderName  string `json:"DecoderName"`
+	Verified     bool   `json:"Verified"`
+	Raw          string `json:"Raw"`
+	Redacted     string `json:"Redacted"`
+}
+
+func init() {
+	RegisterParser("trufflehog", ParseTrufflehogFindings)
+}
+
+// ParseTrufflehogFindings parses the newline-delimited JSON output of trufflehog v3
+func ParseTrufflehogFindings(data []byte) (Findings, error) {
+	f := Findings{}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	// a line holds the raw secret, which can be a whole private key
+	s.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var t trufflehogFinding
+		err := json.Unmarshal(line, &t)
+		if err != nil {
+			return nil, err
+		}
+
+		// older versions don't report the line
+		ln := t.SourceMetadata.Data.Filesystem.Line
+		if ln == 0 {
+			ln = 1
+		}
+
+		f = append(f, Finding{
+			FilePath:        t.SourceMetadata.Data.Filesystem.File,
+			LineNumber:      fmt.Sprintf("%d", ln),
+			RuleDescription: fmt.Sprintf("%s secret", t.DetectorName),
+			RuleID:          t.DetectorName,
+			Scanner:         "trufflehog",
+			Secret:          t.Raw,
+			Verified:        t.Verified,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
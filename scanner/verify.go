@@ -0,0 +1,88 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/salesforce/lobster-pot/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Result of the verification of a secret
+const (
+	VerificationLive    = "live"    // the credential works
+	VerificationRevoked = "revoked" // the provider rejected the credential
+	VerificationUnknown = "unknown" // the provider couldn't be reached, or its answer wasn't conclusive
+)
+
+// Verifier checks whether a detected credential is live, by calling its provider's API
+type Verifier interface {
+	Name() string
+	// Matches returns true if the finding holds a secret of the type handled by the verifier
+	Matches(f Finding) bool
+	// Verify returns VerificationLive, VerificationRevoked or VerificationUnknown
+	Verify(ctx context.Context, f Finding) (string, error)
+}
+
+// VerifierFactory builds a verifier calling endpoint, or the provider's API if endpoint is empty
+type VerifierFactory func(endpoint string, client *http.Client) Verifier
+
+var verifiers = make(map[string]VerifierFactory)
+
+// RegisterVerifier makes a verifier available under name, which is also the suffix of its
+// VERIFIER_ENDPOINT_<NAME> variable. It panics if the name is already registered.
+func RegisterVerifier(name string, factory VerifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := verifiers[name]; dup {
+		panic("scanner: RegisterVerifier called twice for " + name)
+	}
+	verifiers[name] = factory
+}
+
+// VerifyFinding checks the secret of the finding with the first verifier matching it.
+// It returns the verification result and the name of the verifier, or empty strings if
+// no verifier handles that kind of secret.
+func VerifyFinding(c config.Verifiers, f Finding) (result string, verifier string) {
+	// the scanner already checked the secret
+	if f.Verified {
+		return VerificationLive, f.Scanner
+	}
+	if !c.Enabled {
+		return "", ""
+	}
+
+	registryMu.RLock()
+	names := make([]string, 0, len(verifiers))
+	for name := range verifiers {
+		names = append(names, name)
+	}
+	registryMu.RUnlock()
+	sort.Strings(names)
+
+	client := &http.Client{Timeout: c.Timeout}
+	for _, name := range names {
+		registryMu.RLock()
+		v := verifiers[name](c.Endpoints[name], client)
+		registryMu.RUnlock()
+		if !v.Matches(f) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		result, err := v.Verify(ctx, f)
+		cancel()
+		if err != nil {
+			log.WithFields(log.Fields{"verifier": v.Name(), "rule": f.RuleID}).Error("Could not verify secret ", err)
+			return VerificationUnknown, v.Name()
+		}
+		return result, v.Name()
+	}
+
+	return "", ""
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	awsKeyIDRe  = regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)
+	awsSecretRe = regexp.MustCompile(`(?:^|[^A-Za-z0-9/+])([A-Za-z0-9/+=]{40})(?:$|[^A-Za-z0-9/+=])`)
+)
+
+const (
+	awsRegion  = "us-east-1"
+	awsService = "sts"
+	stsBody    = "Action=GetCallerIdentity&Version=2011-06-15"
+)
+
+// awsVerifier checks an AWS access key with the STS GetCallerIdentity call, which needs no permission.
+// The finding must hold both the access key ID and the secret access key: the secret isn't looked for
+// in the rest of the file, so a key whose secret is on another line is always unknown.
+type awsVerifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func init() {
+	RegisterVerifier("aws", func(endpoint string, client *http.Client) Verifier {
+		if endpoint == "" {
+			endpoint = "https://sts.amazonaws.com"
+		}
+		return awsVerifier{endpoint: endpoint, client: client}
+	})
+}
+
+func (v awsVerifier) Name() string {
+	return "aws"
+}
+
+func (v awsVerifier) Matches(f Finding) bool {
+	return awsKeyIDRe.MatchString(f.Secret)
+}
+
+func (v awsVerifier) Verify(ctx context.Context, f Finding) (string, error) {
+	keyID := awsKeyIDRe.FindString(f.Secret)
+	m := awsSecretRe.FindStringSubmatch(strings.Replace(f.Secret, keyID, "", 1))
+	if m == nil {
+		// the secret access key is on another line, nothing to check
+		return VerificationUnknown, nil
+	}
+	secret := m[1]
+
+	u, err := url.Parse(v.endpoint)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint+"/", strings.NewReader(stsBody))
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWSRequest(req, u.Host, keyID, secret, time.Now().UTC())
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return VerificationLive, nil
+	}
+
+	var r struct {
+		Error struct {
+			Code string `xml:"Code"`
+		} `xml:"Error"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return VerificationUnknown, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	switch r.Error.Code {
+	case "InvalidClientTokenId", "SignatureDoesNotMatch", "ExpiredToken":
+		return VerificationRevoked, nil
+	}
+	return VerificationUnknown, nil
+}
+
+// signAWSRequest adds the Signature Version 4 headers to the STS request
+func signAWSRequest(req *http.Request, host, keyID, secret string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	contentType := req.Header.Get("Content-Type")
+
+	payloadHash := sha256.Sum256([]byte(stsBody))
+	canonical := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		"content-type:" + contentType,
+		"host:" + host,
+		"x-amz-date:" + amzDate,
+		"",
+		"content-type;host;x-amz-date",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, awsRegion, awsService)
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, awsRegion)
+	key = hmacSHA256(key, awsService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host;x-amz-date, Signature=%s", keyID, scope, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// githubTokenRe matches the personal, OAuth, user-to-server, server-to-server, refresh and fine-grained tokens
+var githubTokenRe = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)
+
+// githubVerifier checks a GitHub token by fetching the authenticated user
+type githubVerifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func init() {
+	RegisterVerifier("github", func(endpoint string, client *http.Client) Verifier {
+		if endpoint == "" {
+			endpoint = "https://api.github.com"
+		}
+		return githubVerifier{endpoint: endpoint, client: client}
+	})
+}
+
+func (v githubVerifier) Name() string {
+	return "github"
+}
+
+func (v githubVerifier) Matches(f Finding) bool {
+	return githubTokenRe.MatchString(f.Secret)
+}
+
+func (v githubVerifier) Verify(ctx context.Context, f Finding) (string, error) {
+	token := githubTokenRe.FindString(f.Secret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.endpoint+"/user", nil)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return VerificationLive, nil
+	case http.StatusUnauthorized:
+		return VerificationRevoked, nil
+	}
+	return VerificationUnknown, nil
+}
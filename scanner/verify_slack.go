@@ -0,0 +1,76 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+var slackTokenRe = regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`)
+
+// slackVerifier checks a Slack token with the auth.test method
+type slackVerifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func init() {
+	RegisterVerifier("slack", func(endpoint string, client *http.Client) Verifier {
+		if endpoint == "" {
+			endpoint = "https://slack.com/api"
+		}
+		return slackVerifier{endpoint: endpoint, client: client}
+	})
+}
+
+func (v slackVerifier) Name() string {
+	return "slack"
+}
+
+func (v slackVerifier) Matches(f Finding) bool {
+	return slackTokenRe.MatchString(f.Secret)
+}
+
+func (v slackVerifier) Verify(ctx context.Context, f Finding) (string, error) {
+	token := slackTokenRe.FindString(f.Secret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint+"/auth.test", nil)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return VerificationUnknown, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var r struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return VerificationUnknown, err
+	}
+
+	if r.OK {
+		return VerificationLive, nil
+	}
+	switch r.Error {
+	case "invalid_auth", "not_authed", "token_revoked", "token_expired", "account_inactive":
+		return VerificationRevoked, nil
+	}
+	return VerificationUnknown, nil
+}
@@ -5,6 +5,12 @@
 package scanner
 
 import (
+	"context"
+	"sync/atomic"
+
+	"github.com/salesforce/lobster-pot/config"
+	log "github.com/sirupsen/logrus"
+
 	wraith "github.com/N0MoreSecr3ts/wraith/core"
 )
 
@@ -30,8 +36,47 @@ type wraithFinding struct {
 
 type wraithFindings []wraithFinding
 
-func scanWraith(tmpFolder string) (Findings, error) {
+func init() {
+	RegisterEngine("wraith", func(s config.Scanner) (Engine, error) {
+		return engineFunc{name: "wraith", scan: scanWraith}, nil
+	})
+}
+
+// wraithScan runs a wraith scan, replaced by the tests
+var wraithScan = runWraith
+
+// abandonedWraithScans is the number of wraith scans still running after their deadline
+var abandonedWraithScans int64
+
+// scanWraith scans tmpFolder with wraith, and returns when the context is done. Wraith can't be
+// interrupted: the scan is abandoned and its goroutine leaks until wraith completes, its findings
+// being discarded. A hung wraith scan therefore never returns, but doesn't block the job.
+func scanWraith(ctx context.Context, tmpFolder string) (Findings, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan Findings, 1)
+	go func() {
+		done <- wraithScan(tmpFolder)
+	}()
+
+	select {
+	case f := <-done:
+		return f, nil
+	case <-ctx.Done():
+		n := atomic.AddInt64(&abandonedWraithScans, 1)
+		log.WithFields(log.Fields{"event": "scanAbandoned", "scanner": "wraith", "abandoned": n}).Warn("Abandoning the wraith scan, it runs until it completes")
+		go func() {
+			<-done
+			atomic.AddInt64(&abandonedWraithScans, -1)
+		}()
+		return nil, ctx.Err()
+	}
+}
 
+// runWraith scans tmpFolder with wraith, until it completes
+func runWraith(tmpFolder string) Findings {
 	// TODO: Viper.set some variables if needed
 	wraithConfig := wraith.SetConfig()
 	scanType := "localPath"
@@ -48,11 +93,12 @@ func scanWraith(tmpFolder string) (Findings, error) {
 			FilePath:        w.FilePath,
 			LineNumber:      w.LineNumber,
 			RuleDescription: w.Description,
+			RuleID:          w.SignatureID,
 			Scanner:         "wraith",
 			Secret:          w.Content,
 		}
 		f[i] = nf
 	}
 
-	return f, nil
+	return f
 }
@@ -0,0 +1,49 @@
+// Copyright (c) 2022, salesforce.com, inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScanWraithTimeout(t *testing.T) {
+	// a wraith scan hanging until released
+	release := make(chan struct{})
+	defer func(f func(string) Findings) { wraithScan = f }(wraithScan)
+	wraithScan = func(string) Findings {
+		<-release
+		return Findings{{Secret: "late"}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	findings, err := engineFunc{name: "wraith", scan: scanWraith}.Scan(ctx, t.TempDir())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline", err)
+	}
+	if findings != nil {
+		t.Errorf("findings = %+v, want none", findings)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("scan returned after %s, want at the deadline", d)
+	}
+	if n := atomic.LoadInt64(&abandonedWraithScans); n != 1 {
+		t.Errorf("abandoned scans = %d, want 1", n)
+	}
+
+	// the abandoned scan is forgotten once it completes
+	close(release)
+	for i := 0; i < 100 && atomic.LoadInt64(&abandonedWraithScans) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&abandonedWraithScans); n != 0 {
+		t.Errorf("abandoned scans = %d after completion, want 0", n)
+	}
+}